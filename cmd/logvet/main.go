@@ -0,0 +1,402 @@
+//
+// Format strings check for go-log calls
+// go install github.com/ondi/go-log/cmd/logvet@latest
+// go vet -vettool=$(which logvet) ./...
+//
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/types"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/analysis/singlechecker"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+var LogPath = "github.com/ondi/go-log"
+
+var Analyzer = &analysis.Analyzer{
+	Name:     "logvet",
+	Doc:      "check format strings and args of go-log calls, Tag args and json prefix",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+func main() {
+	singlechecker.Main(Analyzer)
+}
+
+func run(pass *analysis.Pass) (any, error) {
+	in := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	in.Preorder([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node) {
+		call := n.(*ast.CallExpr)
+		fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+		if !ok {
+			return
+		}
+		if index := format_index(fn); index > -1 && index < len(call.Args) {
+			check_call(pass, call, fn, index)
+		}
+	})
+	return nil, nil
+}
+
+// index of format for functions and methods of go-log ending with (format string, args ...any)
+func format_index(fn *types.Func) int {
+	if fn.Pkg() == nil || fn.Pkg().Path() != LogPath {
+		return -1
+	}
+	sig, ok := fn.Type().(*types.Signature)
+	if !ok || !sig.Variadic() || sig.Params().Len() < 2 {
+		return -1
+	}
+	n := sig.Params().Len()
+	format := sig.Params().At(n - 2)
+	if format.Name() != "format" || !types.Identical(format.Type(), types.Typ[types.String]) {
+		return -1
+	}
+	if args, ok := sig.Params().At(n - 1).Type().(*types.Slice); !ok || !types.IsInterface(args.Elem()) {
+		return -1
+	}
+	return n - 2
+}
+
+func check_call(pass *analysis.Pass, call *ast.CallExpr, fn *types.Func, index int) {
+	name := fn.Name()
+	args := call.Args[index+1:]
+	tag := tag_interface(fn.Pkg())
+	check_tag_keys(pass, args)
+	if call.Ellipsis.IsValid() {
+		return
+	}
+	tv := pass.TypesInfo.Types[call.Args[index]]
+	if tv.Value == nil || tv.Value.Kind() != constant.String {
+		if len(args) == 0 {
+			pass.Reportf(call.Args[index].Pos(), "non-constant format string in call to %s", name)
+		}
+		return
+	}
+	format := constant.StringVal(tv.Value)
+	// json prefix: Kibana writer sends args as Data array, format is used only by text writers
+	json := strings.HasPrefix(format, "json")
+	if json && len(args) == 0 {
+		pass.Reportf(call.Pos(), "%s format %q: json prefix without args", name, format)
+	}
+	verbs, err := parse_format(format)
+	if err != nil {
+		pass.Reportf(call.Args[index].Pos(), "%s format %q: %v", name, format, err)
+		return
+	}
+	used := make([]bool, len(args))
+	for _, v := range verbs {
+		for _, star := range v.stars {
+			if star >= len(args) {
+				pass.Reportf(call.Pos(), "%s format %s reads arg #%d, but call has %v", name, v.text, star+1, count(len(args), "arg"))
+				return
+			}
+			used[star] = true
+			if t := pass.TypesInfo.Types[args[star]].Type; t != nil && !match_verb('d', t) {
+				pass.Reportf(args[star].Pos(), "%s format %s uses non-int %s as argument of *", name, v.text, types.ExprString(args[star]))
+			}
+		}
+		if v.arg >= len(args) {
+			pass.Reportf(call.Pos(), "%s format %s reads arg #%d, but call has %v", name, v.text, v.arg+1, count(len(args), "arg"))
+			return
+		}
+		used[v.arg] = true
+		check_verb(pass, name, v, args[v.arg], tag)
+	}
+	if json {
+		return
+	}
+	for i, ok := range used {
+		if ok {
+			continue
+		}
+		if is_tag(pass.TypesInfo.Types[args[i]].Type, tag) {
+			pass.Reportf(args[i].Pos(), "%s Tag arg %s has no verb, use %%v or %%.0v to hide it from text", name, types.ExprString(args[i]))
+		} else {
+			pass.Reportf(args[i].Pos(), "%s call has unused arg %s", name, types.ExprString(args[i]))
+		}
+	}
+}
+
+func count(n int, what string) string {
+	if n == 1 {
+		return "1 " + what
+	}
+	return strconv.Itoa(n) + " " + what + "s"
+}
+
+func tag_interface(pkg *types.Package) *types.Interface {
+	if obj, ok := pkg.Scope().Lookup("Tag").(*types.TypeName); ok {
+		if res, ok := obj.Type().Underlying().(*types.Interface); ok {
+			return res
+		}
+	}
+	return nil
+}
+
+func is_tag(t types.Type, tag *types.Interface) bool {
+	if t == nil || tag == nil || types.IsInterface(t) && !types.Identical(t.Underlying(), tag) {
+		return false
+	}
+	return types.Implements(t, tag)
+}
+
+// Tag_t literals with empty or repeated keys, json writers keep last of repeated keys
+func check_tag_keys(pass *analysis.Pass, args []ast.Expr) {
+	keys := map[string]bool{}
+	for _, arg := range args {
+		lit, ok := ast.Unparen(arg).(*ast.CompositeLit)
+		if !ok {
+			continue
+		}
+		named, ok := types.Unalias(pass.TypesInfo.Types[lit].Type).(*types.Named)
+		if !ok || named.Obj().Pkg() == nil || named.Obj().Pkg().Path() != LogPath || named.Obj().Name() != "Tag_t" {
+			continue
+		}
+		var key ast.Expr
+		for i, elt := range lit.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				if ident, ok := kv.Key.(*ast.Ident); ok && ident.Name == "Key" {
+					key = kv.Value
+				}
+			} else if i == 0 {
+				key = elt
+			}
+		}
+		if key == nil {
+			pass.Reportf(lit.Pos(), "Tag with empty key")
+			continue
+		}
+		tv := pass.TypesInfo.Types[key]
+		if tv.Value == nil || tv.Value.Kind() != constant.String {
+			continue
+		}
+		value := constant.StringVal(tv.Value)
+		if len(value) == 0 {
+			pass.Reportf(lit.Pos(), "Tag with empty key")
+		} else if keys[value] {
+			pass.Reportf(lit.Pos(), "repeated Tag key %q", value)
+		}
+		keys[value] = true
+	}
+}
+
+type verb_t struct {
+	text  string // verb with flags
+	verb  rune
+	arg   int
+	stars []int // args of * in width and precision
+}
+
+// verbs of format with indexes of args, explicit [n] indexes are supported
+func parse_format(format string) (res []verb_t, err error) {
+	var arg int
+	for i := 0; i < len(format); {
+		if format[i] != '%' {
+			i++
+			continue
+		}
+		start := i
+		var v verb_t
+		for i++; i < len(format) && strings.IndexByte("+-# 0", format[i]) > -1; i++ {
+		}
+		for part := 0; part < 2; part++ {
+			if part == 1 {
+				if i == len(format) || format[i] != '.' {
+					break
+				}
+				i++
+			}
+			if i, arg, err = parse_index(format, i, arg); err != nil {
+				return
+			}
+			if i < len(format) && format[i] == '*' {
+				v.stars = append(v.stars, arg)
+				arg++
+				i++
+				continue
+			}
+			for ; i < len(format) && format[i] >= '0' && format[i] <= '9'; i++ {
+			}
+		}
+		if i, arg, err = parse_index(format, i, arg); err != nil {
+			return
+		}
+		if i == len(format) {
+			return res, fmt.Errorf("missing verb at end of format")
+		}
+		r, size := utf8.DecodeRuneInString(format[i:])
+		i += size
+		if r == '%' {
+			continue
+		}
+		v.text, v.verb, v.arg = format[start:i], r, arg
+		arg++
+		res = append(res, v)
+	}
+	return
+}
+
+// [n] sets index of next arg to n-1
+func parse_index(format string, i int, arg int) (int, int, error) {
+	if i == len(format) || format[i] != '[' {
+		return i, arg, nil
+	}
+	end := strings.IndexByte(format[i:], ']')
+	if end < 0 {
+		return i, arg, fmt.Errorf("unclosed arg index")
+	}
+	n, err := strconv.Atoi(format[i+1 : i+end])
+	if err != nil || n < 1 {
+		return i, arg, fmt.Errorf("bad arg index %q", format[i:i+end+1])
+	}
+	return i + end + 1, n - 1, nil
+}
+
+func check_verb(pass *analysis.Pass, name string, v verb_t, arg ast.Expr, tag *types.Interface) {
+	t := pass.TypesInfo.Types[arg].Type
+	if t == nil {
+		return
+	}
+	if _, ok := verb_args[v.verb]; !ok {
+		pass.Reportf(arg.Pos(), "%s format %s has unknown verb %c", name, v.text, v.verb)
+		return
+	}
+	if is_tag(t, tag) {
+		if v.verb != 'v' && v.verb != 's' {
+			pass.Reportf(arg.Pos(), "%s format %s has Tag arg %s, use %%v or %%.0v", name, v.text, types.ExprString(arg))
+		}
+		return
+	}
+	if !match_verb(v.verb, t) {
+		pass.Reportf(arg.Pos(), "%s format %s has arg %s of wrong type %s", name, v.text, types.ExprString(arg), t)
+	}
+}
+
+const (
+	arg_bool = 1 << iota
+	arg_int
+	arg_float
+	arg_complex
+	arg_string
+	arg_pointer
+	arg_any = arg_bool | arg_int | arg_float | arg_complex | arg_string | arg_pointer
+)
+
+var verb_args = map[rune]int{
+	'v': arg_any,
+	'T': arg_any,
+	't': arg_bool,
+	'b': arg_int | arg_float | arg_complex | arg_pointer,
+	'c': arg_int,
+	'd': arg_int | arg_pointer,
+	'o': arg_int | arg_pointer,
+	'O': arg_int | arg_pointer,
+	'q': arg_int | arg_string,
+	'x': arg_int | arg_float | arg_complex | arg_string | arg_pointer,
+	'X': arg_int | arg_float | arg_complex | arg_string | arg_pointer,
+	'U': arg_int,
+	'e': arg_float | arg_complex,
+	'E': arg_float | arg_complex,
+	'f': arg_float | arg_complex,
+	'F': arg_float | arg_complex,
+	'g': arg_float | arg_complex,
+	'G': arg_float | arg_complex,
+	's': arg_string,
+	'p': arg_pointer,
+}
+
+// types are checked as fmt prints them: elements of containers and fields of structs
+func match_verb(verb rune, t types.Type) bool {
+	return match_type(verb_args[verb], verb, t, map[types.Type]bool{})
+}
+
+func match_type(want int, verb rune, t types.Type, seen map[types.Type]bool) bool {
+	if want == arg_any || seen[t] {
+		return true
+	}
+	seen[t] = true
+	if has_method(t, "Format") {
+		return true
+	}
+	if strings.ContainsRune("sqxXv", verb) && (has_method(t, "String") || has_method(t, "Error")) {
+		return true
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Kind() == types.UntypedNil:
+			return true
+		case u.Kind() == types.UnsafePointer:
+			return want&arg_pointer != 0
+		case u.Info()&types.IsBoolean != 0:
+			return want&arg_bool != 0
+		case u.Info()&types.IsInteger != 0:
+			return want&arg_int != 0
+		case u.Info()&types.IsFloat != 0:
+			return want&arg_float != 0
+		case u.Info()&types.IsComplex != 0:
+			return want&arg_complex != 0
+		case u.Info()&types.IsString != 0:
+			return want&arg_string != 0
+		}
+		return true
+	case *types.Interface:
+		return true
+	case *types.Pointer:
+		if want&arg_pointer != 0 {
+			return true
+		}
+		// &{...}, &[...] and &map[...] at top level
+		switch u.Elem().Underlying().(type) {
+		case *types.Struct, *types.Array, *types.Slice, *types.Map:
+			if len(seen) == 1 {
+				return match_type(want, verb, u.Elem(), seen)
+			}
+		}
+		return false
+	case *types.Slice:
+		if want&arg_pointer != 0 {
+			return true
+		}
+		if basic, ok := u.Elem().Underlying().(*types.Basic); ok && basic.Kind() == types.Byte && want&arg_string != 0 {
+			return true
+		}
+		return match_type(want, verb, u.Elem(), seen)
+	case *types.Array:
+		if basic, ok := u.Elem().Underlying().(*types.Basic); ok && basic.Kind() == types.Byte && want&arg_string != 0 {
+			return true
+		}
+		return match_type(want, verb, u.Elem(), seen)
+	case *types.Map:
+		return want&arg_pointer != 0 || match_type(want, verb, u.Key(), seen) && match_type(want, verb, u.Elem(), seen)
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			if !match_type(want, verb, u.Field(i).Type(), seen) {
+				return false
+			}
+		}
+		return true
+	case *types.Chan, *types.Signature:
+		return want&arg_pointer != 0
+	}
+	return true
+}
+
+func has_method(t types.Type, name string) bool {
+	obj, _, _ := types.LookupFieldOrMethod(t, false, nil, name)
+	_, ok := obj.(*types.Func)
+	return ok
+}
@@ -0,0 +1,42 @@
+package a
+
+import (
+	"context"
+	"errors"
+
+	log "github.com/ondi/go-log"
+)
+
+type user_t struct {
+	Name string
+	Age  int
+}
+
+func calls(ctx context.Context, format string, args []any) {
+	tag := log.Tag_t{Key: "user", Value: "1"}
+
+	log.Info("%v %d %s %5.2f %x %q %t %p %*d %[1]v", "a", 1, "b", 1.5, []byte("c"), 'r', true, &user_t{}, 3, 4)
+	log.Info("%s %v %.0v", errors.New("e"), user_t{}, tag)
+	log.Info("json", user_t{}, tag)
+	log.Info("json %v", user_t{}, 1)
+	log.Info(format, args...)
+	log.Info(format, 1)
+	log.GetLogger().Log(ctx, 1, "%v", 1)
+	log.Info("JSON decode failed: %v", errors.New("e"))
+	log.Info(" json %v", 1)
+
+	log.Info("%d", "a")                                                    // want `Info format %d has arg "a" of wrong type string`
+	log.Info("%s", 1)                                                      // want `Info format %s has arg 1 of wrong type int`
+	log.Info("%d", user_t{})                                               // want `Info format %d has arg user_t{} of wrong type a.user_t`
+	log.Info("%v %v", 1)                                                   // want `Info format %v reads arg #2, but call has 1 arg`
+	log.Info("%v", 1, 2)                                                   // want `Info call has unused arg 2`
+	log.Info("%w", errors.New("e"))                                        // want `Info format %w has unknown verb w`
+	log.Info("%v %")                                                       // want `Info format "%v %": missing verb at end of format`
+	log.Info(format)                                                       // want `non-constant format string in call to Info`
+	log.Info("value", tag)                                                 // want `Info Tag arg tag has no verb, use %v or %.0v to hide it from text`
+	log.Info("%d", tag)                                                    // want `Info format %d has Tag arg tag, use %v or %.0v`
+	log.InfoCtx(ctx, "%v", log.Tag_t{})                                    // want `Tag with empty key`
+	log.GetLogger().Info("%v%v", log.Tag_t{"k", "1"}, log.Tag_t{Key: "k"}) // want `repeated Tag key "k"`
+	log.GetLogger().InfoCtx(ctx, "json")                                   // want `InfoCtx format "json": json prefix without args`
+	log.GetLogger().Log(ctx, 1, "%[3]v", 1)                                // want `Log format %\[3\]v reads arg #3, but call has 1 arg`
+}
@@ -0,0 +1,35 @@
+package log
+
+import "context"
+
+type Tag interface {
+	TagKey() string
+	TagValue() string
+}
+
+type Tag_t struct {
+	Key   string
+	Value string
+}
+
+func (self Tag_t) TagKey() string {
+	return self.Key
+}
+
+func (self Tag_t) TagValue() string {
+	return self.Value
+}
+
+type Logger interface {
+	Log(ctx context.Context, level int64, format string, args ...any)
+	Info(format string, args ...any)
+	InfoCtx(ctx context.Context, format string, args ...any)
+}
+
+func Info(format string, args ...any) {}
+
+func InfoCtx(ctx context.Context, format string, args ...any) {}
+
+func GetLogger() Logger {
+	return nil
+}
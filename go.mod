@@ -4,6 +4,7 @@ go 1.25
 
 require (
 	github.com/google/uuid v1.6.0
+	github.com/klauspost/compress v1.18.0
 	github.com/ondi/go-cache v0.0.0-20230425151132-e34113a7989a
 	github.com/ondi/go-circular v0.0.0-20250228092841-58964bf0fa4f
 	github.com/ondi/go-queue v0.0.0-20250317094238-17c3d42850aa
@@ -0,0 +1,145 @@
+//
+// ANSI colours for terminal output
+//
+
+package log
+
+import (
+	"io"
+	"os"
+)
+
+var (
+	ColorReset  = "\x1b[0m"
+	ColorDim    = "\x1b[2m"
+	ColorRed    = "\x1b[31m"
+	ColorGreen  = "\x1b[32m"
+	ColorYellow = "\x1b[33m"
+	ColorBlue   = "\x1b[34m"
+	ColorCyan   = "\x1b[36m"
+	ColorGray   = "\x1b[90m"
+)
+
+// ANSI colour of level
+func LevelAnsi(level int64) (res string) {
+	switch level {
+	case 0:
+		res = ColorGray
+	case 1:
+		res = ColorCyan
+	case 2:
+		res = ColorGreen
+	case 3:
+		res = ColorYellow
+	default:
+		res = ColorRed
+	}
+	return
+}
+
+// NO_COLOR disables colours, FORCE_COLOR enables colours for non terminal output
+func ColorEnabled(out *os.File) bool {
+	if len(os.Getenv("NO_COLOR")) > 0 {
+		return false
+	}
+	switch os.Getenv("FORCE_COLOR") {
+	case "", "0", "false":
+	default:
+		return true
+	}
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return IsTerminal(out)
+}
+
+func IsTerminal(out *os.File) bool {
+	info, err := out.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+type PartLevelColor_t struct {
+	prefix string
+	suffix string
+}
+
+// PartLevelName_t with level colour
+func NewPartLevelColor(prefix string, suffix string) Formatter {
+	return &PartLevelColor_t{
+		prefix: prefix,
+		suffix: suffix,
+	}
+}
+
+func (self *PartLevelColor_t) FormatMessage(out io.Writer, in Msg_t) (n int, err error) {
+	io.WriteString(out, self.prefix)
+	io.WriteString(out, LevelAnsi(in.Info.Level))
+	n, err = io.WriteString(out, LevelName(in.Info.Level))
+	io.WriteString(out, ColorReset)
+	io.WriteString(out, self.suffix)
+	io.WriteString(out, " ")
+	return
+}
+
+type PartColor_t struct {
+	color string
+	part  Formatter
+}
+
+// output of part is coloured, empty color - colour of level
+// NewPartColor(ColorDim, NewPartFileLine())
+func NewPartColor(color string, part Formatter) Formatter {
+	return &PartColor_t{
+		color: color,
+		part:  part,
+	}
+}
+
+func (self *PartColor_t) FormatMessage(out io.Writer, in Msg_t) (n int, err error) {
+	w := color_writer_t{out: out, color: self.color}
+	if len(w.color) == 0 {
+		w.color = LevelAnsi(in.Info.Level)
+	}
+	n, err = self.part.FormatMessage(&w, in)
+	if w.started {
+		io.WriteString(out, ColorReset)
+	}
+	return
+}
+
+// colour is written before first non empty write
+type color_writer_t struct {
+	out     io.Writer
+	color   string
+	started bool
+}
+
+func (self *color_writer_t) Write(p []byte) (n int, err error) {
+	if len(p) > 0 && !self.started {
+		self.started = true
+		io.WriteString(self.out, self.color)
+	}
+	return self.out.Write(p)
+}
+
+// date, file:line, context id, level and message, coloured if color
+func NewPartsText(layout string, color bool) []Formatter {
+	if color {
+		return []Formatter{
+			NewPartColor(ColorDim, NewPartDateTime(layout)),
+			NewPartColor(ColorDim, NewPartFileLine()),
+			NewPartBufferId(),
+			NewPartLevelColor("", ""),
+			NewPartTextMessage(),
+			NewPartNewLine(),
+		}
+	}
+	return []Formatter{
+		NewPartDateTime(layout),
+		NewPartFileLine(),
+		NewPartBufferId(),
+		NewPartLevelName("", ""),
+		NewPartTextMessage(),
+		NewPartNewLine(),
+	}
+}
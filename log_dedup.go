@@ -0,0 +1,135 @@
+//
+// Deduplication of repeated messages in front of chat writers
+//
+
+package log
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type dedup_key_t struct {
+	format string
+	file   string
+	line   int
+}
+
+type dedup_value_t struct {
+	last  Msg_t
+	count int
+	start time.Time
+}
+
+type Dedup_t struct {
+	mx     sync.Mutex
+	wg     sync.WaitGroup
+	next   Queue
+	window time.Duration
+	msgs   map[dedup_key_t]*dedup_value_t
+	done   chan struct{}
+}
+
+// first message with same Format and Location is written immediately,
+// repeats are counted and written as single summary at the end of window
+// NewDedup(5*time.Minute, NewQueue(64, 1, 1, log_tg))
+func NewDedup(window time.Duration, next Queue) (self *Dedup_t) {
+	self = &Dedup_t{
+		next:   next,
+		window: window,
+		msgs:   map[dedup_key_t]*dedup_value_t{},
+		done:   make(chan struct{}),
+	}
+	self.wg.Add(1)
+	go self.flush(max(window/10, time.Millisecond))
+	return
+}
+
+func (self *Dedup_t) flush(period time.Duration) {
+	defer self.wg.Done()
+	tick := time.NewTicker(period)
+	defer tick.Stop()
+	for {
+		select {
+		case <-self.done:
+			self.Flush(time.Now().Add(self.window))
+			return
+		case ts := <-tick.C:
+			self.Flush(ts)
+		}
+	}
+}
+
+func (self *Dedup_t) LogWrite(msg []Msg_t) (n int, err error) {
+	var out []Msg_t
+	self.mx.Lock()
+	for _, m := range msg {
+		key := dedup_key_t{format: m.Format, file: m.Info.File, line: m.Info.Line}
+		if v, ok := self.msgs[key]; ok {
+			v.last = m
+			v.count++
+			continue
+		}
+		self.msgs[key] = &dedup_value_t{last: m, start: m.Info.Ts}
+		out = append(out, m)
+	}
+	self.mx.Unlock()
+	if len(out) > 0 {
+		n, err = self.next.LogWrite(out)
+	}
+	return
+}
+
+// writes summaries for windows ended before ts
+func (self *Dedup_t) Flush(ts time.Time) (n int, err error) {
+	var out []Msg_t
+	self.mx.Lock()
+	for k, v := range self.msgs {
+		if ts.Sub(v.start) < self.window {
+			continue
+		}
+		if v.count == 0 {
+			delete(self.msgs, k)
+			continue
+		}
+		summary := Msg_t{
+			Ctx:    v.last.Ctx,
+			Info:   Info_t{Ts: ts, File: v.last.Info.File, Line: v.last.Info.Line, Level: v.last.Info.Level},
+			Format: "repeated %v times in last %v: %s",
+			Args:   []any{v.count, self.window, fmt.Sprintf(v.last.Format, v.last.Args...)},
+		}
+		// Tags are kept for writers, formatted to empty string in text
+		for _, arg := range v.last.Args {
+			if tag, ok := arg.(Tag); ok {
+				summary.Format += "%.0v"
+				summary.Args = append(summary.Args, tag)
+			}
+		}
+		out = append(out, summary)
+		v.count = 0
+		v.start = ts
+	}
+	self.mx.Unlock()
+	if len(out) > 0 {
+		n, err = self.next.LogWrite(out)
+	}
+	return
+}
+
+func (self *Dedup_t) Size() QueueSize_t {
+	return self.next.Size()
+}
+
+func (self *Dedup_t) Reopen() (err error) {
+	if temp, ok := self.next.(Reopener); ok {
+		err = temp.Reopen()
+	}
+	return
+}
+
+func (self *Dedup_t) Close() error {
+	close(self.done)
+	self.wg.Wait()
+	return self.next.Close()
+}
@@ -0,0 +1,322 @@
+//
+// Appending json encoder without reflection for formatters
+//
+
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+	"unsafe"
+)
+
+var JsonPoolLimit = 64 * 1024
+
+var json_pool = sync.Pool{
+	New: func() any {
+		return &JsonEncoder_t{buf: make([]byte, 0, 1024)}
+	},
+}
+
+type JsonEncoder_t struct {
+	buf   []byte
+	comma bool
+}
+
+// encoder from pool, use PutJsonEncoder after write
+func GetJsonEncoder() *JsonEncoder_t {
+	return json_pool.Get().(*JsonEncoder_t)
+}
+
+// large buffers are not returned to pool
+func PutJsonEncoder(self *JsonEncoder_t) {
+	if cap(self.buf) > JsonPoolLimit {
+		return
+	}
+	self.Reset()
+	json_pool.Put(self)
+}
+
+func (self *JsonEncoder_t) Reset() {
+	self.buf = self.buf[:0]
+	self.comma = false
+}
+
+func (self *JsonEncoder_t) Bytes() []byte {
+	return self.buf
+}
+
+func (self *JsonEncoder_t) Len() int {
+	return len(self.buf)
+}
+
+func (self *JsonEncoder_t) WriteTo(out io.Writer) (n int64, err error) {
+	temp, err := out.Write(self.buf)
+	return int64(temp), err
+}
+
+func (self *JsonEncoder_t) value() {
+	if self.comma {
+		self.buf = append(self.buf, ',')
+	}
+	self.comma = true
+}
+
+func (self *JsonEncoder_t) ObjectStart() {
+	self.value()
+	self.buf = append(self.buf, '{')
+	self.comma = false
+}
+
+func (self *JsonEncoder_t) ObjectEnd() {
+	self.buf = append(self.buf, '}')
+	self.comma = true
+}
+
+func (self *JsonEncoder_t) ArrayStart() {
+	self.value()
+	self.buf = append(self.buf, '[')
+	self.comma = false
+}
+
+func (self *JsonEncoder_t) ArrayEnd() {
+	self.buf = append(self.buf, ']')
+	self.comma = true
+}
+
+// ends json line
+func (self *JsonEncoder_t) NewLine() {
+	self.buf = append(self.buf, '\n')
+	self.comma = false
+}
+
+func (self *JsonEncoder_t) Key(key string) {
+	self.value()
+	self.buf = AppendJsonString(self.buf, key)
+	self.buf = append(self.buf, ':')
+	self.comma = false
+}
+
+// removes key and value written after mark if value is empty string
+func (self *JsonEncoder_t) OmitEmpty(mark int) {
+	if n := len(self.buf); n-mark > 3 && string(self.buf[n-3:]) == `:""` {
+		self.buf = self.buf[:mark]
+		self.comma = mark > 0 && self.buf[mark-1] != '{' && self.buf[mark-1] != '['
+	}
+}
+
+func (self *JsonEncoder_t) String(in string) {
+	self.value()
+	self.buf = AppendJsonString(self.buf, in)
+}
+
+func (self *JsonEncoder_t) Int(in int64) {
+	self.value()
+	self.buf = strconv.AppendInt(self.buf, in, 10)
+}
+
+func (self *JsonEncoder_t) Uint(in uint64) {
+	self.value()
+	self.buf = strconv.AppendUint(self.buf, in, 10)
+}
+
+func (self *JsonEncoder_t) Bool(in bool) {
+	self.value()
+	self.buf = strconv.AppendBool(self.buf, in)
+}
+
+// same format as encoding/json, NaN and Inf are errors
+func (self *JsonEncoder_t) Float(in float64, bits int) (err error) {
+	if math.IsNaN(in) || math.IsInf(in, 0) {
+		return fmt.Errorf("json: unsupported value: %v", in)
+	}
+	self.value()
+	format := byte('f')
+	if abs := math.Abs(in); abs != 0 && (bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21)) {
+		format = 'e'
+	}
+	n := len(self.buf)
+	self.buf = strconv.AppendFloat(self.buf, in, format, -1, bits)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		if m := len(self.buf) - n; m >= 4 && self.buf[n+m-4] == 'e' && self.buf[n+m-3] == '-' && self.buf[n+m-2] == '0' {
+			self.buf[n+m-2] = self.buf[n+m-1]
+			self.buf = self.buf[:n+m-1]
+		}
+	}
+	return
+}
+
+func (self *JsonEncoder_t) Time(in time.Time, layout string) {
+	self.value()
+	self.buf = append(self.buf, '"')
+	self.buf = in.AppendFormat(self.buf, layout)
+	self.buf = append(self.buf, '"')
+}
+
+// nanoseconds as encoding/json
+func (self *JsonEncoder_t) Duration(in time.Duration) {
+	self.Int(int64(in))
+}
+
+// in must be valid json
+func (self *JsonEncoder_t) Raw(in []byte) {
+	self.value()
+	self.buf = append(self.buf, in...)
+}
+
+// formatted string is escaped without intermediate string, limit > 0 truncates unescaped text
+func (self *JsonEncoder_t) Format(limit int, format string, args ...any) {
+	self.StringStart()
+	if limit > 0 {
+		fmt.Fprintf(&LimitWriter_t{Buf: self.StringWriter(), Limit: limit}, format, args...)
+	} else {
+		fmt.Fprintf(self.StringWriter(), format, args...)
+	}
+	self.StringEnd()
+}
+
+// string value written in parts by StringWriter
+func (self *JsonEncoder_t) StringStart() {
+	self.value()
+	self.buf = append(self.buf, '"')
+}
+
+func (self *JsonEncoder_t) StringEnd() {
+	self.buf = append(self.buf, '"')
+}
+
+// escapes everything written until StringEnd
+func (self *JsonEncoder_t) StringWriter() io.Writer {
+	return (*json_escape_t)(self)
+}
+
+// fast path for common types, others by encoding/json
+func (self *JsonEncoder_t) Any(in any) (err error) {
+	switch v := in.(type) {
+	case nil:
+		self.Raw([]byte("null"))
+	case string:
+		self.String(v)
+	case bool:
+		self.Bool(v)
+	case int:
+		self.Int(int64(v))
+	case int8:
+		self.Int(int64(v))
+	case int16:
+		self.Int(int64(v))
+	case int32:
+		self.Int(int64(v))
+	case int64:
+		self.Int(v)
+	case uint:
+		self.Uint(uint64(v))
+	case uint8:
+		self.Uint(uint64(v))
+	case uint16:
+		self.Uint(uint64(v))
+	case uint32:
+		self.Uint(uint64(v))
+	case uint64:
+		self.Uint(v)
+	case float32:
+		err = self.Float(float64(v), 32)
+	case float64:
+		err = self.Float(v, 64)
+	case time.Time:
+		self.Time(v, time.RFC3339Nano)
+	case time.Duration:
+		self.Duration(v)
+	case json.RawMessage:
+		self.Raw(v)
+	case *Lazy_t:
+		err = self.Any(v.Value())
+	case Tag_t:
+		self.ObjectStart()
+		self.Key("key")
+		self.String(v.Key)
+		self.Key("value")
+		self.String(v.Value)
+		self.ObjectEnd()
+	default:
+		var temp []byte
+		if temp, err = json.Marshal(v); err == nil {
+			self.Raw(temp)
+		}
+	}
+	return
+}
+
+type json_escape_t JsonEncoder_t
+
+// p is not retained
+func (self *json_escape_t) Write(p []byte) (n int, err error) {
+	self.buf = append_json_escape(self.buf, unsafe.String(unsafe.SliceData(p), len(p)))
+	return len(p), nil
+}
+
+func (self *json_escape_t) WriteString(p string) (n int, err error) {
+	self.buf = append_json_escape(self.buf, p)
+	return len(p), nil
+}
+
+const json_hex = "0123456789abcdef"
+
+func AppendJsonString(b []byte, in string) []byte {
+	b = append(b, '"')
+	b = append_json_escape(b, in)
+	return append(b, '"')
+}
+
+// invalid utf-8 is replaced with U+FFFD, U+2028 and U+2029 are escaped as in encoding/json, html is not escaped
+func append_json_escape(b []byte, in string) []byte {
+	start := 0
+	for i := 0; i < len(in); {
+		if c := in[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			b = append(b, in[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', json_hex[c>>4], json_hex[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(in[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, in[start:i]...)
+			b = append(b, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, in[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', json_hex[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	return append(b, in[start:]...)
+}
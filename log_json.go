@@ -0,0 +1,244 @@
+//
+// Json formatter with configurable schema
+//
+
+package log
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// names of fields, empty name - field is omitted
+type JsonSchema_t struct {
+	Time           string
+	TimeLayout     string // time layout or "unix", "unixms", "unixus", "unixns" for numbers, empty is time.RFC3339Nano
+	Level          string
+	LevelName      func(level int64) string
+	Message        string
+	Location       string // "dir/file.go:10"
+	File           string
+	Line           string
+	SourceLocation string // {"file":"dir/file.go","line":"10"}
+	ContextId      string
+	TraceProject   string // context id is written as "projects/<TraceProject>/traces/<id>"
+	AppName        string
+	AppVersion     string
+	Tags           string // {"key":"value"}
+	FlattenTags    bool   // tags are written as top-level fields, tags with reserved names get "tag." prefix
+	Static         []Tag_t
+}
+
+// same fields as PartJsonMessage_t
+var JsonSchemaDefault = JsonSchema_t{
+	Time:       "dt",
+	Level:      "level",
+	Message:    "message",
+	Location:   "location",
+	ContextId:  "context_id",
+	AppName:    "app_name",
+	AppVersion: "app_version",
+	Tags:       "tags",
+}
+
+// Elastic Common Schema
+var JsonSchemaECS = JsonSchema_t{
+	Time:       "@timestamp",
+	TimeLayout: "2006-01-02T15:04:05.000Z07:00",
+	Level:      "log.level",
+	LevelName:  LevelNameLower,
+	Message:    "message",
+	File:       "log.origin.file.name",
+	Line:       "log.origin.file.line",
+	ContextId:  "trace.id",
+	AppName:    "service.name",
+	AppVersion: "service.version",
+	Tags:       "labels",
+	Static:     []Tag_t{{Key: "ecs.version", Value: "8.11.0"}},
+}
+
+// Google Cloud Logging structured payload, set TraceProject to link context id with Cloud Trace
+var JsonSchemaGCP = JsonSchema_t{
+	Time:           "time",
+	Level:          "severity",
+	LevelName:      LevelSeverity,
+	Message:        "message",
+	SourceLocation: "logging.googleapis.com/sourceLocation",
+	ContextId:      "logging.googleapis.com/trace",
+	Tags:           "logging.googleapis.com/labels",
+}
+
+// Datadog reserved attributes
+var JsonSchemaDatadog = JsonSchema_t{
+	Time:        "timestamp",
+	TimeLayout:  "unixms",
+	Level:       "status",
+	LevelName:   LevelNameLower,
+	Message:     "message",
+	Location:    "logger.name",
+	ContextId:   "dd.trace_id",
+	AppName:     "service",
+	AppVersion:  "version",
+	FlattenTags: true,
+}
+
+type PartJsonSchema_t struct {
+	Schema     JsonSchema_t
+	AppName    string
+	AppVersion string
+	reserved   map[string]bool
+}
+
+// NewPartJsonSchema(JsonSchemaECS, "app", "1.0")
+func NewPartJsonSchema(schema JsonSchema_t, AppName string, AppVersion string) Formatter {
+	if schema.LevelName == nil {
+		schema.LevelName = LevelName
+	}
+	reserved := map[string]bool{}
+	for _, v := range []string{schema.Time, schema.Level, schema.Message, schema.Location, schema.File, schema.Line,
+		schema.SourceLocation, schema.ContextId, schema.AppName, schema.AppVersion, schema.Tags} {
+		if len(v) > 0 {
+			reserved[v] = true
+		}
+	}
+	for _, v := range schema.Static {
+		reserved[v.Key] = true
+	}
+	return &PartJsonSchema_t{
+		Schema:     schema,
+		AppName:    AppName,
+		AppVersion: AppVersion,
+		reserved:   reserved,
+	}
+}
+
+func (self *PartJsonSchema_t) FormatMessage(out io.Writer, in Msg_t) (n int, err error) {
+	enc := GetJsonEncoder()
+	defer PutJsonEncoder(enc)
+	enc.ObjectStart()
+	if len(self.Schema.Time) > 0 {
+		enc.Key(self.Schema.Time)
+		switch self.Schema.TimeLayout {
+		case "unix":
+			enc.Int(in.Info.Ts.Unix())
+		case "unixms":
+			enc.Int(in.Info.Ts.UnixMilli())
+		case "unixus":
+			enc.Int(in.Info.Ts.UnixMicro())
+		case "unixns":
+			enc.Int(in.Info.Ts.UnixNano())
+		case "":
+			enc.Time(in.Info.Ts, time.RFC3339Nano)
+		default:
+			enc.Time(in.Info.Ts, self.Schema.TimeLayout)
+		}
+	}
+	if len(self.Schema.Level) > 0 {
+		enc.Key(self.Schema.Level)
+		enc.String(self.Schema.LevelName(in.Info.Level))
+	}
+	if len(self.Schema.Message) > 0 {
+		enc.Key(self.Schema.Message)
+		enc.Format(0, in.Format, in.Args...)
+	}
+	if len(self.Schema.Location) > 0 {
+		enc.Key(self.Schema.Location)
+		enc.String(FileLine(in.Info.File, in.Info.Line))
+	}
+	if len(self.Schema.File) > 0 {
+		enc.Key(self.Schema.File)
+		file := FileLine(in.Info.File, in.Info.Line)
+		enc.String(file[:strings.LastIndexByte(file, ':')])
+	}
+	if len(self.Schema.Line) > 0 {
+		enc.Key(self.Schema.Line)
+		enc.Int(int64(in.Info.Line))
+	}
+	if len(self.Schema.SourceLocation) > 0 {
+		var b [24]byte
+		enc.Key(self.Schema.SourceLocation)
+		enc.ObjectStart()
+		file := FileLine(in.Info.File, in.Info.Line)
+		enc.Key("file")
+		enc.String(file[:strings.LastIndexByte(file, ':')])
+		enc.Key("line")
+		enc.Raw(append(strconv.AppendInt(append(b[:0], '"'), int64(in.Info.Line), 10), '"'))
+		enc.ObjectEnd()
+	}
+	if len(self.Schema.ContextId) > 0 {
+		if v := GetLogBuffer(in.Ctx); v != nil {
+			if id := v.BufferGet("id"); len(id) > 0 {
+				enc.Key(self.Schema.ContextId)
+				if len(self.Schema.TraceProject) > 0 {
+					enc.String("projects/" + self.Schema.TraceProject + "/traces/" + id)
+				} else {
+					enc.String(id)
+				}
+			}
+		}
+	}
+	if len(self.Schema.AppName) > 0 && len(self.AppName) > 0 {
+		enc.Key(self.Schema.AppName)
+		enc.String(self.AppName)
+	}
+	if len(self.Schema.AppVersion) > 0 && len(self.AppVersion) > 0 {
+		enc.Key(self.Schema.AppVersion)
+		enc.String(self.AppVersion)
+	}
+	for _, v := range self.Schema.Static {
+		enc.Key(v.Key)
+		enc.String(v.Value)
+	}
+	var tags bool
+	for i, v := range in.Args {
+		temp, ok := v.(Tag)
+		if !ok || tag_repeated(temp.TagKey(), in.Args[i+1:]) {
+			continue
+		}
+		if !self.Schema.FlattenTags {
+			if len(self.Schema.Tags) == 0 {
+				continue
+			}
+			if !tags {
+				enc.Key(self.Schema.Tags)
+				enc.ObjectStart()
+				tags = true
+			}
+			enc.Key(temp.TagKey())
+		} else if key := temp.TagKey(); self.reserved[key] {
+			enc.Key("tag." + key)
+		} else {
+			enc.Key(key)
+		}
+		enc.String(temp.TagValue())
+	}
+	if tags {
+		enc.ObjectEnd()
+	}
+	enc.ObjectEnd()
+	enc.NewLine()
+	return out.Write(enc.Bytes())
+}
+
+func LevelNameLower(in int64) string {
+	return strings.ToLower(LevelName(in))
+}
+
+// severity of Google Cloud Logging
+func LevelSeverity(in int64) (res string) {
+	switch in {
+	case 0, 1:
+		res = "DEBUG"
+	case 2:
+		res = "INFO"
+	case 3:
+		res = "WARNING"
+	case 4:
+		res = "ERROR"
+	default:
+		res = "DEFAULT"
+	}
+	return
+}
@@ -0,0 +1,231 @@
+//
+// Lazy args and capture of args before queue
+//
+
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Lazy_t struct {
+	once  sync.Once
+	fn    func() any
+	value any
+}
+
+// fn is called at most once per message, result is shared by all writers
+// log.Debug("state %v", log.Lazy(func() any { return expensive() }))
+func Lazy(fn func() any) *Lazy_t {
+	return &Lazy_t{fn: fn}
+}
+
+func (self *Lazy_t) Value() any {
+	self.once.Do(func() {
+		self.value = self.fn()
+		self.fn = nil
+	})
+	return self.value
+}
+
+func (self *Lazy_t) Format(f fmt.State, verb rune) {
+	fmt.Fprintf(f, fmt.FormatString(f, verb), self.Value())
+}
+
+func (self *Lazy_t) MarshalJSON() ([]byte, error) {
+	return json.Marshal(self.Value())
+}
+
+// arg formatted before queue, json is kept for messages with "json" format
+type rendered_t struct {
+	text string
+	json []byte
+}
+
+func (self rendered_t) Format(f fmt.State, verb rune) {
+	f.Write([]byte(self.text))
+}
+
+func (self rendered_t) MarshalJSON() ([]byte, error) {
+	if self.json != nil {
+		return self.json, nil
+	}
+	return json.Marshal(self.text)
+}
+
+func render_arg(format string, verb string, v any) (res rendered_t) {
+	if len(verb) == 0 {
+		verb = "%v"
+	}
+	res.text = fmt.Sprintf(verb, v)
+	if strings.HasPrefix(format, "json") {
+		res.json, _ = json.Marshal(v)
+	}
+	return
+}
+
+// verbs of args, * width and precision are replaced with values of args
+func arg_verbs(format string, args []any) (verbs []string) {
+	verbs = make([]string, len(args))
+	scan_format(format, func(arg int, literal string, verb string) bool {
+		if arg >= len(verbs) {
+			return true
+		}
+		stars := strings.Count(verb, "*")
+		for i := arg - stars; i < arg && len(verb) > 0; i++ {
+			if n, ok := args[i].(int); ok {
+				verb = strings.Replace(verb, "*", strconv.Itoa(n), 1)
+			} else {
+				verb = ""
+			}
+		}
+		verbs[arg] = verb
+		return true
+	})
+	return
+}
+
+// returns copy of args where mutable values are formatted with their verbs, Tags are copied to Tag_t
+func RenderArgs(format string, args []any) (res []any) {
+	res = make([]any, len(args))
+	verbs := arg_verbs(format, args)
+	for i, v := range args {
+		if temp, ok := v.(*Lazy_t); ok {
+			v = temp.Value()
+		}
+		switch temp := v.(type) {
+		case nil, string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr, float32, float64, complex64, complex128, time.Time, time.Duration, Tag_t:
+			res[i] = v
+		case Tag:
+			res[i] = Tag_t{Key: temp.TagKey(), Value: temp.TagValue()}
+		default:
+			res[i] = render_arg(format, verbs[i], v)
+		}
+	}
+	return
+}
+
+// returns copy of args where maps and slices of known types are copied, Tags are copied to Tag_t,
+// other mutable values are formatted as by RenderArgs
+func CopyArgs(format string, args []any) (res []any) {
+	res = make([]any, len(args))
+	var verbs []string
+	for i, v := range args {
+		var ok bool
+		if res[i], ok = copy_value(v); ok {
+			continue
+		}
+		if verbs == nil {
+			verbs = arg_verbs(format, args)
+		}
+		res[i] = render_arg(format, verbs[i], res[i])
+	}
+	return
+}
+
+// returns copy of in and true if in is immutable or copied
+func copy_value(in any) (res any, ok bool) {
+	if temp, ok := in.(*Lazy_t); ok {
+		in = temp.Value()
+	}
+	switch v := in.(type) {
+	case nil, string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr, float32, float64, complex64, complex128, time.Time, time.Duration, Tag_t:
+		return v, true
+	case Tag:
+		return Tag_t{Key: v.TagKey(), Value: v.TagValue()}, true
+	case []byte:
+		return append([]byte(nil), v...), true
+	case []string:
+		return append([]string(nil), v...), true
+	case []int:
+		return append([]int(nil), v...), true
+	case []int64:
+		return append([]int64(nil), v...), true
+	case []float64:
+		return append([]float64(nil), v...), true
+	case []any:
+		temp := make([]any, len(v))
+		for i := range v {
+			if temp[i], ok = copy_value(v[i]); !ok {
+				return in, false
+			}
+		}
+		return temp, true
+	case map[string]string:
+		temp := make(map[string]string, len(v))
+		for k, v := range v {
+			temp[k] = v
+		}
+		return temp, true
+	case map[string]int:
+		temp := make(map[string]int, len(v))
+		for k, v := range v {
+			temp[k] = v
+		}
+		return temp, true
+	case map[string]any:
+		temp := make(map[string]any, len(v))
+		for k, v := range v {
+			if temp[k], ok = copy_value(v); !ok {
+				return in, false
+			}
+		}
+		return temp, true
+	}
+	// named basic types
+	switch reflect.TypeOf(in).Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128, reflect.String:
+		return in, true
+	}
+	return in, false
+}
+
+// message is formatted to text, Tags are kept as Tag_t for formatters
+func RenderMessage(format string, args []any) (string, []any) {
+	res := []any{rendered_t{text: fmt.Sprintf(format, args...)}}
+	format = "%v"
+	for _, v := range args {
+		if temp, ok := v.(Tag); ok {
+			res = append(res, Tag_t{Key: temp.TagKey(), Value: temp.TagValue()})
+			// Tag_t is formatted to empty string
+			format += "%.0v"
+		}
+	}
+	return format, res
+}
+
+// calls fn for each verb with index of arg, literal text before verb and verb with flags
+// scan stops at explicit argument index or when fn returns false
+func scan_format(format string, fn func(arg int, literal string, verb string) bool) {
+	var arg, start int
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		literal, begin := format[start:i], i
+		for i++; i < len(format) && strings.IndexByte("+-# 0123456789.*[]", format[i]) > -1; i++ {
+			switch format[i] {
+			case '*':
+				arg++
+			case '[':
+				return
+			}
+		}
+		if i == len(format) || format[i] == '%' {
+			continue
+		}
+		if !fn(arg, literal, format[begin:i+1]) {
+			return
+		}
+		arg++
+		start = i + 1
+	}
+}
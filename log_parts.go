@@ -5,13 +5,15 @@
 package log
 
 import (
-	"encoding/json"
+	"bytes"
 	"fmt"
 	"io"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Tag interface {
@@ -99,15 +101,65 @@ func (self *PartBufferId_t) FormatMessage(out io.Writer, in Msg_t) (n int, err e
 	return
 }
 
-type PartTextMessage_t struct{}
+type PartTextMessage_t struct {
+	multiline string
+	marker    string
+}
 
 func NewPartTextMessage() Formatter {
 	return &PartTextMessage_t{}
 }
 
+// multiline policy for messages with newlines and control characters:
+// "escape" - control characters are escaped as \n, \r, \t, \x1b
+// "indent" - continuation lines start with marker, other control characters are escaped
+// "fold" - newlines and other control characters except tab are escaped, message is written as single line
+// "" - message is written verbatim
+func NewPartTextMultiline(multiline string, marker string) Formatter {
+	return &PartTextMessage_t{
+		multiline: multiline,
+		marker:    marker,
+	}
+}
+
 func (self *PartTextMessage_t) FormatMessage(out io.Writer, in Msg_t) (n int, err error) {
-	n, err = fmt.Fprintf(out, in.Format, in.Args...)
-	return
+	if len(self.multiline) == 0 {
+		n, err = fmt.Fprintf(out, in.Format, in.Args...)
+		return
+	}
+	var temp1, temp2 [512]byte
+	return out.Write(AppendMultiline(temp2[:0], fmt.Appendf(temp1[:0], in.Format, in.Args...), self.multiline, self.marker))
+}
+
+// appends in with multiline policy, trailing newlines are removed by "indent" and "fold"
+func AppendMultiline(b []byte, in []byte, multiline string, marker string) []byte {
+	if multiline == "indent" || multiline == "fold" {
+		in = bytes.TrimRight(in, "\r\n")
+	}
+	for i := 0; i < len(in); i++ {
+		c := in[i]
+		if c >= 0x20 && c != 0x7f {
+			b = append(b, c)
+			continue
+		}
+		switch {
+		case c == '\n' && multiline == "indent":
+			b = append(b, '\n')
+			b = append(b, marker...)
+		case c == '\r' && multiline == "indent" && i+1 < len(in) && in[i+1] == '\n':
+		case c == '\t' && multiline != "escape":
+			b = append(b, c)
+		case c == '\n':
+			b = append(b, '\\', 'n')
+		case c == '\r':
+			b = append(b, '\\', 'r')
+		case c == '\t':
+			b = append(b, '\\', 't')
+		default:
+			b = append(b, '\\', 'x', json_hex[c>>4], json_hex[c&0xF])
+		}
+	}
+	return b
 }
 
 type PartNewLine_t struct{}
@@ -139,29 +191,145 @@ func NewPartJsonMessage(AppName string, AppVersion string) Formatter {
 	}
 }
 
+// fields in order of PartJsonMessage_t, tags in order of args, last tag with same key wins
 func (self *PartJsonMessage_t) FormatMessage(out io.Writer, in Msg_t) (n int, err error) {
-	msg := PartJsonMessage_t{
-		Level:      LevelName(in.Info.Level),
-		Message:    fmt.Sprintf(in.Format, in.Args...),
-		Location:   FileLine(in.Info.File, in.Info.Line),
-		AppName:    self.AppName,
-		AppVersion: self.AppVersion,
-		Ts:         in.Info.Ts,
-	}
-	msg.Tags = map[string]string{}
+	enc := GetJsonEncoder()
+	defer PutJsonEncoder(enc)
+	enc.ObjectStart()
+	enc.Key("level")
+	enc.String(LevelName(in.Info.Level))
+	mark := enc.Len()
+	enc.Key("message")
+	enc.Format(0, in.Format, in.Args...)
+	enc.OmitEmpty(mark)
+	var tags bool
+	for i, v := range in.Args {
+		if temp, ok := v.(Tag); ok && !tag_repeated(temp.TagKey(), in.Args[i+1:]) {
+			if !tags {
+				enc.Key("tags")
+				enc.ObjectStart()
+				tags = true
+			}
+			enc.Key(temp.TagKey())
+			enc.String(temp.TagValue())
+		}
+	}
+	if tags {
+		enc.ObjectEnd()
+	}
+	enc.Key("location")
+	enc.String(FileLine(in.Info.File, in.Info.Line))
+	if v := GetLogBuffer(in.Ctx); v != nil {
+		if id := v.BufferGet("id"); len(id) > 0 {
+			enc.Key("context_id")
+			enc.String(id)
+		}
+	}
+	if len(self.AppName) > 0 {
+		enc.Key("app_name")
+		enc.String(self.AppName)
+	}
+	if len(self.AppVersion) > 0 {
+		enc.Key("app_version")
+		enc.String(self.AppVersion)
+	}
+	enc.Key("dt")
+	enc.Time(in.Info.Ts, time.RFC3339Nano)
+	enc.ObjectEnd()
+	enc.NewLine()
+	return out.Write(enc.Bytes())
+}
+
+func tag_repeated(key string, args []any) bool {
+	for _, v := range args {
+		if temp, ok := v.(Tag); ok && temp.TagKey() == key {
+			return true
+		}
+	}
+	return false
+}
+
+type PartLogfmt_t struct {
+	Layout     string
+	AppName    string
+	AppVersion string
+}
+
+// ts=2006-01-02T15:04:05Z level=info caller=dir/file.go:10 msg="text" app=name version=1.0 id=ctx key=value
+// empty layout is time.RFC3339Nano
+func NewPartLogfmt(layout string, AppName string, AppVersion string) Formatter {
+	if len(layout) == 0 {
+		layout = time.RFC3339Nano
+	}
+	return &PartLogfmt_t{
+		Layout:     layout,
+		AppName:    AppName,
+		AppVersion: AppVersion,
+	}
+}
+
+func (self *PartLogfmt_t) FormatMessage(out io.Writer, in Msg_t) (n int, err error) {
+	b := make([]byte, 0, 256)
+	b = append(b, "ts="...)
+	b = LogfmtValue(b, in.Info.Ts.Format(self.Layout))
+	b = append(b, " level="...)
+	b = LogfmtValue(b, strings.ToLower(LevelName(in.Info.Level)))
+	b = append(b, " caller="...)
+	b = LogfmtValue(b, FileLine(in.Info.File, in.Info.Line))
+	b = append(b, " msg="...)
+	b = LogfmtValue(b, fmt.Sprintf(in.Format, in.Args...))
+	if len(self.AppName) > 0 {
+		b = append(b, " app="...)
+		b = LogfmtValue(b, self.AppName)
+	}
+	if len(self.AppVersion) > 0 {
+		b = append(b, " version="...)
+		b = LogfmtValue(b, self.AppVersion)
+	}
+	if v := GetLogBuffer(in.Ctx); v != nil {
+		if id := v.BufferGet("id"); len(id) > 0 {
+			b = append(b, " id="...)
+			b = LogfmtValue(b, id)
+		}
+	}
 	for _, v := range in.Args {
 		if temp, ok := v.(Tag); ok {
-			msg.Tags[temp.TagKey()] = temp.TagValue()
+			b = append(b, ' ')
+			b = LogfmtKey(b, temp.TagKey())
+			b = append(b, '=')
+			b = LogfmtValue(b, temp.TagValue())
 		}
 	}
-	if v := GetLogBuffer(in.Ctx); v != nil {
-		msg.ContextId = v.BufferGet("id")
+	b = append(b, '\n')
+	return out.Write(b)
+}
+
+// characters not allowed in key are replaced with underscore
+func LogfmtKey(b []byte, key string) []byte {
+	if len(key) == 0 {
+		return append(b, '_')
 	}
-	if err = json.NewEncoder(out).Encode(msg); err != nil {
-		return
+	for _, r := range key {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError || !unicode.IsPrint(r) {
+			b = append(b, '_')
+		} else {
+			b = utf8.AppendRune(b, r)
+		}
 	}
-	n++
-	return
+	return b
+}
+
+// value is quoted if empty or contains space, equal sign, quote or non printable characters
+func LogfmtValue(b []byte, value string) []byte {
+	if len(value) == 0 {
+		return append(b, `""`...)
+	}
+	for _, r := range value {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == utf8.RuneError || !unicode.IsPrint(r) {
+			return strconv.AppendQuote(b, value)
+		}
+	}
+	return append(b, value...)
 }
 
 func LevelName(in int64) (res string) {
@@ -6,6 +6,7 @@ package log
 
 import (
 	"errors"
+	"strings"
 	"sync"
 
 	"github.com/ondi/go-queue"
@@ -17,15 +18,44 @@ type Queue_t struct {
 	wg              sync.WaitGroup
 	mx              sync.Mutex
 	q               queue.Queue[Msg_t]
+	w               Queue
 	queue_write     int
 	queue_read      int
 	queue_overflow  int
 	write_error_cnt int
 	write_error_msg string
+	capture         string
 }
 
-func NewQueue(limit int, writers int, bulk_write int, w Queue) (self *Queue_t) {
-	self = &Queue_t{}
+type QueueOption func(self *Queue_t)
+
+// args are captured before enqueue, caller may change args after log call
+// each arg is formatted by RenderArgs
+func QueueRender() QueueOption {
+	return func(self *Queue_t) {
+		self.capture = "render"
+	}
+}
+
+// known maps and slices are copied by CopyArgs, other mutable args are formatted
+func QueueCopy() QueueOption {
+	return func(self *Queue_t) {
+		self.capture = "copy"
+	}
+}
+
+// whole message is formatted by RenderMessage, args of "json" format are copied by CopyArgs
+func QueueBytes() QueueOption {
+	return func(self *Queue_t) {
+		self.capture = "bytes"
+	}
+}
+
+func NewQueue(limit int, writers int, bulk_write int, w Queue, opts ...QueueOption) (self *Queue_t) {
+	self = &Queue_t{w: w}
+	for _, opt := range opts {
+		opt(self)
+	}
 	self.q = queue.NewOpen[Msg_t](&self.mx, limit)
 	for i := 0; i < writers; i++ {
 		self.wg.Add(1)
@@ -48,6 +78,13 @@ func (self *Queue_t) writer(bulk_write int, w Queue) (err error) {
 }
 
 func (self *Queue_t) LogWrite(msg []Msg_t) (n int, err error) {
+	if len(self.capture) > 0 {
+		temp := make([]Msg_t, len(msg))
+		for i, m := range msg {
+			temp[i] = self.Capture(m)
+		}
+		msg = temp
+	}
 	self.mx.Lock()
 	defer self.mx.Unlock()
 	self.queue_write += len(msg)
@@ -61,6 +98,23 @@ func (self *Queue_t) LogWrite(msg []Msg_t) (n int, err error) {
 	return
 }
 
+func (self *Queue_t) Capture(m Msg_t) Msg_t {
+	switch self.capture {
+	case "render":
+		m.Args = RenderArgs(m.Format, m.Args)
+	case "bytes":
+		// json messages keep args for formatters
+		if strings.HasPrefix(m.Format, "json") {
+			m.Args = CopyArgs(m.Format, m.Args)
+		} else {
+			m.Format, m.Args = RenderMessage(m.Format, m.Args)
+		}
+	case "copy":
+		m.Args = CopyArgs(m.Format, m.Args)
+	}
+	return m
+}
+
 // LogRead(p []Msg_t) (n int, ok bool) - bad design
 // messages stay in buffer forever and not garbage-collected
 func (self *Queue_t) LogRead(limit int) (res []Msg_t, ok bool) {
@@ -103,6 +157,14 @@ func (self *Queue_t) Size() (res QueueSize_t) {
 	return
 }
 
+// reopens underlying writer if supported
+func (self *Queue_t) Reopen() (err error) {
+	if temp, ok := self.w.(Reopener); ok {
+		err = temp.Reopen()
+	}
+	return
+}
+
 func (self *Queue_t) Close() (err error) {
 	self.mx.Lock()
 	self.q.Close()
@@ -0,0 +1,357 @@
+//
+// Redaction of secrets in front of writers
+//
+
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var RedactKeysDefault = []string{"password", "passwd", "secret", "token", "authorization", "api_key", "apikey", "cookie"}
+
+// arg implementing Redactable is replaced with result of Redact before formatting
+type Redactable interface {
+	Redact() any
+}
+
+type redact_rule_t struct {
+	re      *regexp.Regexp
+	replace string
+	valid   func(match string) bool
+}
+
+type Redact_t struct {
+	next       Queue
+	mask       string
+	keys       []string
+	rules      []redact_rule_t
+	jwt        bool
+	bearer     bool
+	card       bool
+	key_re     *regexp.Regexp
+	key_fmt    *regexp.Regexp
+	bearer_fmt *regexp.Regexp
+}
+
+type RedactOption func(self *Redact_t)
+
+// Tags and fields with key containing one of keys are masked, case insensitive
+func RedactKeys(keys ...string) RedactOption {
+	return func(self *Redact_t) {
+		self.keys = append(self.keys, keys...)
+	}
+}
+
+// matches of re are replaced with replace, $1 expands to first group
+func RedactRegexp(re *regexp.Regexp, replace string) RedactOption {
+	return func(self *Redact_t) {
+		self.rules = append(self.rules, redact_rule_t{re: re, replace: replace})
+	}
+}
+
+func RedactJWT() RedactOption {
+	return func(self *Redact_t) {
+		self.jwt = true
+	}
+}
+
+// any value after "Authorization: Bearer", token-shaped values after bearer or basic in text
+func RedactBearer() RedactOption {
+	return func(self *Redact_t) {
+		self.bearer = true
+	}
+}
+
+// numbers of 13-19 digits passing Luhn check
+func RedactCreditCard() RedactOption {
+	return func(self *Redact_t) {
+		self.card = true
+	}
+}
+
+// RedactKeysDefault, JWT, bearer tokens and credit cards
+func RedactDefaults() RedactOption {
+	return func(self *Redact_t) {
+		self.keys = append(self.keys, RedactKeysDefault...)
+		self.jwt = true
+		self.bearer = true
+		self.card = true
+	}
+}
+
+// replacement of secrets, default "***"
+func RedactMask(mask string) RedactOption {
+	return func(self *Redact_t) {
+		self.mask = mask
+	}
+}
+
+// without options RedactDefaults is used, writers to external sinks may have stricter rules
+// NewRedact(NewQueue(64, 1, 1, log_tg), RedactDefaults(), RedactKeys("email", "phone"))
+func NewRedact(next Queue, opts ...RedactOption) (self *Redact_t) {
+	self = &Redact_t{
+		next: next,
+		mask: "***",
+	}
+	if len(opts) == 0 {
+		opts = append(opts, RedactDefaults())
+	}
+	for _, opt := range opts {
+		opt(self)
+	}
+	if self.jwt {
+		self.rules = append(self.rules, redact_rule_t{re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), replace: self.mask})
+	}
+	if self.bearer {
+		// any value after Authorization, token-shaped value after bearer or basic in text
+		self.rules = append(self.rules,
+			redact_rule_t{re: regexp.MustCompile(`(?i)(authorization["']?\s*[:=]\s*["']?(?:bearer|basic)\s+)[A-Za-z0-9\-._~+/]+=*`), replace: "${1}" + self.mask},
+			redact_rule_t{re: regexp.MustCompile(`(?i)\b(bearer|basic)\s+([A-Za-z0-9\-._~+/]+=*)`), replace: "$1 " + self.mask, valid: bearer_token},
+		)
+		self.bearer_fmt = regexp.MustCompile(`(?i)\b(bearer|basic)\s+$`)
+	}
+	if self.card {
+		self.rules = append(self.rules, redact_rule_t{re: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), replace: self.mask, valid: Luhn})
+	}
+	if len(self.keys) > 0 {
+		var keys []string
+		for _, v := range self.keys {
+			keys = append(keys, strings.ReplaceAll(regexp.QuoteMeta(v), "_", "[-_]"))
+		}
+		group := `(?i)((?:` + strings.Join(keys, "|") + `)[\w-]*["']?\s*[=:]\s*["']?)`
+		// key=value, "key": "value" inside formatted args
+		self.key_re = regexp.MustCompile(group + `(?:(?i:bearer|basic)\s+)?[^\s"'&,;)\]}]+`)
+		// key= at the end of literal text before verb, whole arg is masked
+		self.key_fmt = regexp.MustCompile(group + `$`)
+		for i, v := range self.keys {
+			self.keys[i] = strings.ReplaceAll(strings.ToLower(v), "-", "_")
+		}
+	}
+	return
+}
+
+func (self *Redact_t) LogWrite(msg []Msg_t) (n int, err error) {
+	out := make([]Msg_t, len(msg))
+	for i, m := range msg {
+		out[i] = m
+		out[i].Format = self.Literals(m.Format)
+		out[i].Args = self.Args(m.Format, m.Args)
+	}
+	return self.next.LogWrite(out)
+}
+
+// returns copy of args with secrets replaced
+func (self *Redact_t) Args(format string, args []any) (res []any) {
+	res = make([]any, len(args))
+	masked := self.masked(format, len(args))
+	stars := star_args(format, len(args))
+	for i, v := range args {
+		if temp, ok := v.(Redactable); ok {
+			v = temp.Redact()
+		}
+		if _, ok := v.(int); ok && i < len(stars) && stars[i] {
+			res[i] = v
+			continue
+		}
+		switch temp := v.(type) {
+		case nil, bool:
+			res[i] = v
+		case Tag:
+			if self.Key(temp.TagKey()) {
+				res[i] = Tag_t{Key: temp.TagKey(), Value: self.mask}
+			} else if value := self.String(temp.TagValue()); value != temp.TagValue() {
+				res[i] = Tag_t{Key: temp.TagKey(), Value: value}
+			} else {
+				res[i] = v
+			}
+		default:
+			if i < len(masked) && masked[i] {
+				res[i] = self.mask
+			} else {
+				res[i] = &redact_arg_t{redact: self, value: v}
+			}
+		}
+	}
+	return
+}
+
+// key contains one of secret keys, dash and underscore are same
+func (self *Redact_t) Key(key string) bool {
+	key = strings.ReplaceAll(strings.ToLower(key), "-", "_")
+	for _, v := range self.keys {
+		if strings.Contains(key, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// applies rules to in
+func (self *Redact_t) String(in string) string {
+	if self.key_re != nil {
+		in = self.key_re.ReplaceAllString(in, "${1}"+self.mask)
+	}
+	for _, v := range self.rules {
+		if v.valid == nil {
+			in = v.re.ReplaceAllString(in, v.replace)
+			continue
+		}
+		in = v.re.ReplaceAllStringFunc(in, func(match string) string {
+			if v.valid(match) {
+				return string(v.re.ExpandString(nil, v.replace, match, v.re.FindStringSubmatchIndex(match)))
+			}
+			return match
+		})
+	}
+	return in
+}
+
+// applies rules to literal text of format, verbs are kept
+// log.Info("Authorization: Bearer " + token)
+func (self *Redact_t) Literals(format string) string {
+	var b strings.Builder
+	var start int
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		b.WriteString(self.literal(format[start:i]))
+		begin := i
+		for i++; i < len(format) && strings.IndexByte("+-# 0123456789.*[]", format[i]) > -1; i++ {
+		}
+		if i < len(format) {
+			_, size := utf8.DecodeRuneInString(format[i:])
+			i += size - 1
+		}
+		b.WriteString(format[begin:min(i+1, len(format))])
+		start = i + 1
+	}
+	if start < len(format) {
+		b.WriteString(self.literal(format[start:]))
+	}
+	return b.String()
+}
+
+// percent sign of mask is escaped
+func (self *Redact_t) literal(in string) string {
+	if res := self.String(in); res != in {
+		return strings.ReplaceAll(res, "%", "%%")
+	}
+	return in
+}
+
+// args formatted by verbs preceded by secret key or auth scheme in format: "password=%v", "Bearer %s"
+func (self *Redact_t) masked(format string, count int) (res []bool) {
+	if self.key_fmt == nil && self.bearer_fmt == nil {
+		return
+	}
+	scan_format(format, func(arg int, literal string, verb string) bool {
+		if arg < count && (self.key_fmt != nil && self.key_fmt.MatchString(literal) || self.bearer_fmt != nil && self.bearer_fmt.MatchString(literal)) {
+			if res == nil {
+				res = make([]bool, count)
+			}
+			res[arg] = true
+		}
+		return true
+	})
+	return
+}
+
+// args used as width or precision by *
+func star_args(format string, count int) (res []bool) {
+	scan_format(format, func(arg int, literal string, verb string) bool {
+		for i := max(arg-strings.Count(verb, "*"), 0); i < arg && i < count; i++ {
+			if res == nil {
+				res = make([]bool, count)
+			}
+			res[i] = true
+		}
+		return true
+	})
+	return
+}
+
+// formatted with original verb and flags, rules are applied to result
+type redact_arg_t struct {
+	redact *Redact_t
+	value  any
+}
+
+func (self *redact_arg_t) Format(f fmt.State, verb rune) {
+	io.WriteString(f, self.redact.String(fmt.Sprintf(fmt.FormatString(f, verb), self.value)))
+}
+
+func (self *redact_arg_t) MarshalJSON() ([]byte, error) {
+	temp, err := json.Marshal(self.value)
+	if err != nil {
+		return nil, err
+	}
+	// masked numbers are not valid json
+	res := self.redact.String(string(temp))
+	if res != string(temp) && !json.Valid([]byte(res)) {
+		return json.Marshal(self.redact.mask)
+	}
+	return []byte(res), nil
+}
+
+func (self *Redact_t) Size() QueueSize_t {
+	return self.next.Size()
+}
+
+func (self *Redact_t) Reopen() (err error) {
+	if temp, ok := self.next.(Reopener); ok {
+		err = temp.Reopen()
+	}
+	return
+}
+
+func (self *Redact_t) Close() error {
+	return self.next.Close()
+}
+
+// token after bearer or basic has digits, symbols of base64 or mixed case, not a word of text
+func bearer_token(match string) bool {
+	token := strings.TrimRight(match[strings.LastIndexAny(match, " \t\r\n")+1:], ".")
+	if len(token) < 6 {
+		return false
+	}
+	var upper bool
+	for i := 0; i < len(token); i++ {
+		switch c := token[i]; {
+		case c >= '0' && c <= '9', strings.IndexByte("+/=_~", c) > -1:
+			return true
+		case c >= 'A' && c <= 'Z' && i > 0:
+			upper = true
+		}
+	}
+	return upper
+}
+
+// Luhn checksum of digits in number, spaces and dashes are ignored
+func Luhn(number string) bool {
+	var sum, count int
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		if count%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		count++
+	}
+	return count >= 13 && sum%10 == 0
+}
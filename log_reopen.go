@@ -0,0 +1,57 @@
+//
+// Reopen of log files after external rotation (logrotate)
+//
+
+package log
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+type Reopener interface {
+	Reopen() error
+}
+
+// calls Reopen() once for every writer of logger
+func Reopen(logger Logger) (errs []error) {
+	done := map[Reopener]bool{}
+	logger.Range(func(level_id int64, writer_name string, writer Queue) bool {
+		if temp, ok := writer.(Reopener); ok && !done[temp] {
+			done[temp] = true
+			if err := temp.Reopen(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return true
+	})
+	return
+}
+
+// reopens writers of GetLogger() on signals, SIGHUP by default
+// postrotate: kill -HUP `cat /run/app.pid`
+func ReopenOnSignal(signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGHUP}
+	}
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, signals...)
+	go func() {
+		for {
+			select {
+			case <-ch:
+				for _, err := range Reopen(GetLogger()) {
+					LogStderr("LOG REOPEN: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
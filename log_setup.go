@@ -4,21 +4,44 @@ Logs:
     LogLevel: 0
     LogDate: "2006-01-02 15:04:05"
 
+  - LogType: "q_logfmt_stderr"
+    LogLevel: 2
+    LogQueue: 1024
+    LogWriters: 1
+    LogCapture: "copy"
+
   - LogType: "file"
     LogLevel: 0
     LogDate: "2006-01-02 15:04:05"
     LogFile: "all.log"
+    LogMultiline: "indent"
+    LogMultiMarker: "  | "
     LogSize: 10000000
     LogDuration: "24h"
     LogBackup: 15
+    LogCompress: "gzip"
+
+  - LogType: "rotate"
+    LogLevel: 0
+    LogDate: "2006-01-02 15:04:05"
+    LogFile: "app-%Y%m%d-%H.%i.log.gz"
+    LogFormat: "{ts:2006-01-02 15:04:05.000} {caller} [{level,-5}] {ctx.id} {msg}"
+    LogLink: "app.log"
+    LogSize: 10000000
+    LogDuration: "1h"
+    LogLocation: "Europe/Moscow"
+    LogBackup: 48
 
   - LogType: "file"
     LogLevel: 3
     LogDate: "2006-01-02 15:04:05"
-    LogFile: "warn.log"
+    LogFile: "/var/log/app/warn.log"
     LogSize: 10000000
     LogDuration: "24h"
     LogBackup: 15
+    LogFileMode: "0640"
+    LogDirMode: "0750"
+    LogOwner: ":1000"
 
 	for k, v := range cfg.Kibana {
 		log_http := log.NewWriterHttp(
@@ -37,7 +60,7 @@ Logs:
 			log.PostHeader(v),
 			log.RpsLimit(log.NewRps(time.Second, 100, 1000)),
 		)
-		log.GetLogger().SwapLevelMap(log.GetLogger().CopyLevelMap().AddOutputs(k, log.NewQueue(1024, v.Writers, 1024, log_http), log.WhatLevel(v.Level)))
+		log.GetLogger().SwapLevelMap(log.GetLogger().CopyLevelMap().AddOutputs(k, log.NewRedact(log.NewQueue(1024, v.Writers, 1024, log_http)), log.WhatLevel(v.Level)))
 		self.log_http[k] = log_http
 	}
 	for k, v := range cfg.Telegram {
@@ -52,9 +75,21 @@ Logs:
 			log.PostHeader(v),
 			log.PostDelay(1500*time.Millisecond),
 		)
-		log.GetLogger().SwapLevelMap(log.GetLogger().CopyLevelMap().AddOutputs(k, log.NewQueue(64, v.Writers, 1, log_tg), log.WhatLevel(v.Level)))
+		log.GetLogger().SwapLevelMap(log.GetLogger().CopyLevelMap().AddOutputs(k, log.NewDedup(5*time.Minute, log.NewRedact(log.NewQueue(64, v.Writers, 1, log_tg), log.RedactDefaults(), log.RedactKeys("email", "phone"))), log.WhatLevel(v.Level)))
 		self.log_tg[k] = log_tg
 	}
+	for k, v := range cfg.Slack {
+		log_slack := log.NewWriterHttp(
+			log.NewUrls(v.WebhookUrl),
+			log.MessageSlack_t{
+				ApplicationName: v.AppName,
+				Hostname:        self.hostname,
+			},
+			self.client,
+			log.PostDelay(1500*time.Millisecond),
+		)
+		log.GetLogger().SwapLevelMap(log.GetLogger().CopyLevelMap().AddOutputs(k, log.NewQueue(64, v.Writers, 1, log_slack), log.WhatLevel(v.Level)))
+	}
 */
 
 package log
@@ -68,6 +103,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -79,29 +115,43 @@ var (
 )
 
 type Args_t struct {
-	LogType     string        `yaml:"LogType"`
-	LogFile     string        `yaml:"LogFile"`
-	LogDate     string        `yaml:"LogDate"`
-	LogLevel    int64         `yaml:"LogLevel"`
-	LogLimit    int           `yaml:"LogLimit"`
-	LogSize     int           `yaml:"LogSize"`
-	LogBackup   int           `yaml:"LogBackup"`
-	LogQueue    int           `yaml:"LogQueue"`
-	LogWriters  int           `yaml:"LogWriters"`
-	LogDuration time.Duration `yaml:"LogDuration"`
+	LogType          string        `yaml:"LogType"`
+	LogFile          string        `yaml:"LogFile"`
+	LogDate          string        `yaml:"LogDate"`
+	LogLevel         int64         `yaml:"LogLevel"`
+	LogLimit         int           `yaml:"LogLimit"`
+	LogSize          int           `yaml:"LogSize"`
+	LogBackup        int           `yaml:"LogBackup"`
+	LogQueue         int           `yaml:"LogQueue"`
+	LogWriters       int           `yaml:"LogWriters"`
+	LogDuration      time.Duration `yaml:"LogDuration"`
+	LogCompress      string        `yaml:"LogCompress"`
+	LogBackupSize    int64         `yaml:"LogBackupSize"`
+	LogBackupAge     time.Duration `yaml:"LogBackupAge"`
+	LogAppend        bool          `yaml:"LogAppend"`
+	LogRotateOnStart bool          `yaml:"LogRotateOnStart"`
+	LogLink          string        `yaml:"LogLink"`
+	LogLocation      string        `yaml:"LogLocation"`
+	LogPeriod        string        `yaml:"LogPeriod"`
+	LogReopenCheck   time.Duration `yaml:"LogReopenCheck"`
+	LogBuffer        int           `yaml:"LogBuffer"`
+	LogFlush         time.Duration `yaml:"LogFlush"`
+	LogMinFree       int64         `yaml:"LogMinFree"`
+	LogMinFreeCheck  time.Duration `yaml:"LogMinFreeCheck"`
+	LogMinFreePolicy string        `yaml:"LogMinFreePolicy"`
+	LogFileMode      string        `yaml:"LogFileMode"`
+	LogDirMode       string        `yaml:"LogDirMode"`
+	LogOwner         string        `yaml:"LogOwner"`
+	LogFormat        string        `yaml:"LogFormat"`
+	LogMultiline     string        `yaml:"LogMultiline"`
+	LogMultiMarker   string        `yaml:"LogMultiMarker"`
+	LogCapture       string        `yaml:"LogCapture"`
 }
 
 func NewLogger() (out Logger) {
 	m := NewLevelMap()
 	w1 := NewWriterStdany(
-		[]Formatter{
-			NewPartDateTime("2006-01-02 15:04:05.000"),
-			NewPartFileLine(),
-			NewPartBufferId(),
-			NewPartLevelName("", ""),
-			NewPartTextMessage(),
-			NewPartNewLine(),
-		},
+		NewPartsText("2006-01-02 15:04:05.000", ColorEnabled(os.Stderr)),
 		os.Stderr,
 		0,
 	)
@@ -137,63 +187,209 @@ func LogStderr(format string, args ...any) {
 func SetupLogger(ts time.Time, logs []Args_t, app_name string, app_version string) (out Logger, errs []string) {
 	m := NewLevelMap()
 	for _, v := range logs {
+		opts, err := file_options(v)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%v %v", v.LogType, err.Error()))
+			continue
+		}
+		parts, err := text_parts(v)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%v %v", v.LogType, err.Error()))
+			continue
+		}
+		capture, err := queue_capture(v.LogCapture)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%v %v", v.LogType, err.Error()))
+			continue
+		}
 		switch v.LogType {
 		case "buf":
 			m.AddOutputs("buf", NewLogBufferWriter(), WhatLevel(v.LogLevel))
 		case "file":
-			if output, err := NewWriterFileBytes(ts, v.LogFile, []Formatter{NewPartDateTime(v.LogDate), NewPartFileLine(), NewPartBufferId(), NewPartLevelName("", ""), NewPartTextMessage(), NewPartNewLine()}, v.LogSize, v.LogBackup, v.LogLimit); err != nil {
+			if output, err := NewWriterFileBytes(ts, v.LogFile, parts, v.LogSize, v.LogBackup, v.LogLimit, opts...); err != nil {
 				errs = append(errs, fmt.Sprintf("%v %v", v.LogType, err.Error()))
 			} else {
 				m.AddOutputs(v.LogFile, output, WhatLevel(v.LogLevel))
 			}
 		case "q_file":
-			fq, err := NewWriterFileBytes(ts, v.LogFile, []Formatter{NewPartDateTime(v.LogDate), NewPartFileLine(), NewPartBufferId(), NewPartLevelName("", ""), NewPartTextMessage(), NewPartNewLine()}, v.LogSize, v.LogBackup, v.LogLimit)
+			fq, err := NewWriterFileBytes(ts, v.LogFile, parts, v.LogSize, v.LogBackup, v.LogLimit, opts...)
 			if err != nil {
 				errs = append(errs, fmt.Sprintf("%v %v", v.LogType, err.Error()))
 			} else {
-				m.AddOutputs(v.LogFile, NewQueue(v.LogQueue, v.LogWriters, 1, fq), WhatLevel(v.LogLevel))
+				m.AddOutputs(v.LogFile, NewQueue(v.LogQueue, v.LogWriters, 1, fq, capture), WhatLevel(v.LogLevel))
 			}
 		case "filetime":
-			if output, err := NewWriterFileTime(ts, v.LogFile, []Formatter{NewPartDateTime(v.LogDate), NewPartFileLine(), NewPartBufferId(), NewPartLevelName("", ""), NewPartTextMessage(), NewPartNewLine()}, v.LogDuration, v.LogBackup, v.LogLimit); err != nil {
+			if output, err := NewWriterFileTime(ts, v.LogFile, parts, v.LogDuration, v.LogBackup, v.LogLimit, opts...); err != nil {
 				errs = append(errs, fmt.Sprintf("%v %v", v.LogType, err.Error()))
 			} else {
 				m.AddOutputs(v.LogFile, output, WhatLevel(v.LogLevel))
 			}
 		case "q_filetime":
-			fq, err := NewWriterFileTime(ts, v.LogFile, []Formatter{NewPartDateTime(v.LogDate), NewPartFileLine(), NewPartBufferId(), NewPartLevelName("", ""), NewPartTextMessage(), NewPartNewLine()}, v.LogDuration, v.LogBackup, v.LogLimit)
+			fq, err := NewWriterFileTime(ts, v.LogFile, parts, v.LogDuration, v.LogBackup, v.LogLimit, opts...)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%v %v", v.LogType, err.Error()))
+			} else {
+				m.AddOutputs(v.LogFile, NewQueue(v.LogQueue, v.LogWriters, 1, fq, capture), WhatLevel(v.LogLevel))
+			}
+		case "rotate":
+			if output, err := NewWriterFileRotate(ts, v.LogFile, v.LogLink, parts, v.LogSize, v.LogDuration, v.LogBackup, v.LogLimit, opts...); err != nil {
+				errs = append(errs, fmt.Sprintf("%v %v", v.LogType, err.Error()))
+			} else {
+				m.AddOutputs(v.LogFile, output, WhatLevel(v.LogLevel))
+			}
+		case "q_rotate":
+			fq, err := NewWriterFileRotate(ts, v.LogFile, v.LogLink, parts, v.LogSize, v.LogDuration, v.LogBackup, v.LogLimit, opts...)
 			if err != nil {
 				errs = append(errs, fmt.Sprintf("%v %v", v.LogType, err.Error()))
 			} else {
-				m.AddOutputs(v.LogFile, NewQueue(v.LogQueue, v.LogWriters, 1, fq), WhatLevel(v.LogLevel))
+				m.AddOutputs(v.LogFile, NewQueue(v.LogQueue, v.LogWriters, 1, fq, capture), WhatLevel(v.LogLevel))
 			}
 		case "stdout":
-			m.AddOutputs("stdout", NewWriterStdany([]Formatter{NewPartDateTime(v.LogDate), NewPartFileLine(), NewPartBufferId(), NewPartLevelName("", ""), NewPartTextMessage(), NewPartNewLine()}, os.Stdout, v.LogLimit), WhatLevel(v.LogLevel))
+			m.AddOutputs("stdout", NewWriterStdany(color_parts(v, parts, os.Stdout), os.Stdout, v.LogLimit), WhatLevel(v.LogLevel))
 		case "stdout2":
 			m.AddOutputs("stdout2", NewWriterStdany([]Formatter{NewPartDateTime(v.LogDate), NewPartFileLine(), NewPartBufferId(), NewPartLevelName("_", "_"), NewPartTextMessage(), NewPartNewLine()}, os.Stdout, v.LogLimit), WhatLevel(v.LogLevel))
 		case "q_stdout":
-			q := NewWriterStdany([]Formatter{NewPartDateTime(v.LogDate), NewPartFileLine(), NewPartBufferId(), NewPartLevelName("", ""), NewPartTextMessage(), NewPartNewLine()}, os.Stdout, v.LogLimit)
-			m.AddOutputs("stdoutqueue", NewQueue(v.LogQueue, v.LogWriters, 1, q), WhatLevel(v.LogLevel))
+			q := NewWriterStdany(color_parts(v, parts, os.Stdout), os.Stdout, v.LogLimit)
+			m.AddOutputs("stdoutqueue", NewQueue(v.LogQueue, v.LogWriters, 1, q, capture), WhatLevel(v.LogLevel))
 		case "stderr":
-			m.AddOutputs("stderr", NewWriterStdany([]Formatter{NewPartDateTime(v.LogDate), NewPartFileLine(), NewPartBufferId(), NewPartLevelName("", ""), NewPartTextMessage(), NewPartNewLine()}, os.Stderr, v.LogLimit), WhatLevel(v.LogLevel))
+			m.AddOutputs("stderr", NewWriterStdany(color_parts(v, parts, os.Stderr), os.Stderr, v.LogLimit), WhatLevel(v.LogLevel))
 		case "q_stderr":
-			q := NewWriterStdany([]Formatter{NewPartDateTime(v.LogDate), NewPartFileLine(), NewPartBufferId(), NewPartLevelName("", ""), NewPartTextMessage(), NewPartNewLine()}, os.Stderr, v.LogLimit)
-			m.AddOutputs("stderrqueue", NewQueue(v.LogQueue, v.LogWriters, 1, q), WhatLevel(v.LogLevel))
+			q := NewWriterStdany(color_parts(v, parts, os.Stderr), os.Stderr, v.LogLimit)
+			m.AddOutputs("stderrqueue", NewQueue(v.LogQueue, v.LogWriters, 1, q, capture), WhatLevel(v.LogLevel))
 		case "q_json_stdout":
 			q := NewWriterStdany([]Formatter{NewPartJsonMessage(app_name, app_version)}, os.Stdout, v.LogLimit)
-			m.AddOutputs("stderrqueue", NewQueue(v.LogQueue, v.LogWriters, 1, q), WhatLevel(v.LogLevel))
+			m.AddOutputs("stderrqueue", NewQueue(v.LogQueue, v.LogWriters, 1, q, capture), WhatLevel(v.LogLevel))
 		case "q_json_stderr":
 			q := NewWriterStdany([]Formatter{NewPartJsonMessage(app_name, app_version)}, os.Stderr, v.LogLimit)
-			m.AddOutputs("stderrqueue", NewQueue(v.LogQueue, v.LogWriters, 1, q), WhatLevel(v.LogLevel))
+			m.AddOutputs("stderrqueue", NewQueue(v.LogQueue, v.LogWriters, 1, q, capture), WhatLevel(v.LogLevel))
+		case "logfmt_stdout":
+			m.AddOutputs("stdout", NewWriterStdany([]Formatter{NewPartLogfmt(v.LogDate, app_name, app_version)}, os.Stdout, v.LogLimit), WhatLevel(v.LogLevel))
+		case "q_logfmt_stdout":
+			q := NewWriterStdany([]Formatter{NewPartLogfmt(v.LogDate, app_name, app_version)}, os.Stdout, v.LogLimit)
+			m.AddOutputs("stdoutqueue", NewQueue(v.LogQueue, v.LogWriters, 1, q, capture), WhatLevel(v.LogLevel))
+		case "logfmt_stderr":
+			m.AddOutputs("stderr", NewWriterStdany([]Formatter{NewPartLogfmt(v.LogDate, app_name, app_version)}, os.Stderr, v.LogLimit), WhatLevel(v.LogLevel))
+		case "q_logfmt_stderr":
+			q := NewWriterStdany([]Formatter{NewPartLogfmt(v.LogDate, app_name, app_version)}, os.Stderr, v.LogLimit)
+			m.AddOutputs("stderrqueue", NewQueue(v.LogQueue, v.LogWriters, 1, q, capture), WhatLevel(v.LogLevel))
 		}
 	}
 	out = New(m)
 	return
 }
 
+// LogCapture: "render", "copy", "bytes" or "" - args are not captured
+func queue_capture(mode string) (QueueOption, error) {
+	switch mode {
+	case "":
+		return func(*Queue_t) {}, nil
+	case "render":
+		return QueueRender(), nil
+	case "copy":
+		return QueueCopy(), nil
+	case "bytes":
+		return QueueBytes(), nil
+	}
+	return nil, fmt.Errorf("unknown LogCapture %q", mode)
+}
+
+// LogFormat template or default parts with LogDate
+func text_parts(v Args_t) ([]Formatter, error) {
+	switch v.LogMultiline {
+	case "", "escape", "indent", "fold":
+	default:
+		return nil, fmt.Errorf("unknown LogMultiline %q", v.LogMultiline)
+	}
+	if len(v.LogFormat) == 0 {
+		return default_parts(v, false), nil
+	}
+	part, err := NewPartTemplateMultiline(v.LogFormat, v.LogMultiline, v.LogMultiMarker)
+	if err != nil {
+		return nil, err
+	}
+	return []Formatter{part, NewPartNewLine()}, nil
+}
+
+// default parts are coloured on terminal
+func color_parts(v Args_t, parts []Formatter, out *os.File) []Formatter {
+	if len(v.LogFormat) == 0 && ColorEnabled(out) {
+		return default_parts(v, true)
+	}
+	return parts
+}
+
+func default_parts(v Args_t, color bool) (res []Formatter) {
+	res = NewPartsText(v.LogDate, color)
+	if len(v.LogMultiline) > 0 {
+		for i, part := range res {
+			if _, ok := part.(*PartTextMessage_t); ok {
+				res[i] = NewPartTextMultiline(v.LogMultiline, v.LogMultiMarker)
+			}
+		}
+	}
+	return
+}
+
+func file_options(v Args_t) (res []FileOption, err error) {
+	res = []FileOption{
+		FileCompress(v.LogCompress),
+		FileMaxTotal(v.LogBackupSize),
+		FileMaxAge(v.LogBackupAge),
+		FilePeriod(v.LogPeriod),
+		FileReopenCheck(v.LogReopenCheck),
+		FileBuffer(v.LogBuffer, v.LogFlush),
+		FileMinFree(v.LogMinFree, v.LogMinFreeCheck, v.LogMinFreePolicy),
+	}
+	if len(v.LogLocation) > 0 {
+		location, err := time.LoadLocation(v.LogLocation)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, FileLocation(location))
+	}
+	if len(v.LogFileMode) > 0 {
+		mode, err := strconv.ParseUint(v.LogFileMode, 8, 32)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, FileMode(os.FileMode(mode)))
+	}
+	if len(v.LogDirMode) > 0 {
+		mode, err := strconv.ParseUint(v.LogDirMode, 8, 32)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, FileDirMode(os.FileMode(mode)))
+	}
+	if len(v.LogOwner) > 0 {
+		// "uid:gid", empty part keeps value unchanged
+		uid, gid := -1, -1
+		user, group, _ := strings.Cut(v.LogOwner, ":")
+		if len(user) > 0 {
+			if uid, err = strconv.Atoi(user); err != nil {
+				return nil, err
+			}
+		}
+		if len(group) > 0 {
+			if gid, err = strconv.Atoi(group); err != nil {
+				return nil, err
+			}
+		}
+		res = append(res, FileOwner(uid, gid))
+	}
+	if v.LogAppend {
+		res = append(res, FileAppend())
+	}
+	if v.LogRotateOnStart {
+		res = append(res, FileRotateOnStart())
+	}
+	return
+}
+
 func SetupPrint(logs []Args_t, errs []string, log_debug func(string, ...any)) {
 	for _, v := range logs {
-		log_debug("LOG OUTPUT: LogLevel=%v, LogLimit=%v, LogType=%v, LogFile=%v, LogSize=%v, LogDuration=%v, LogBackup=%v, LogQueue=%v, LogWriters=%v",
-			v.LogLevel, v.LogLimit, v.LogType, v.LogFile, ByteSize(uint64(v.LogSize)), v.LogDuration, v.LogBackup, v.LogQueue, v.LogWriters)
+		log_debug("LOG OUTPUT: LogLevel=%v, LogLimit=%v, LogType=%v, LogFile=%v, LogSize=%v, LogDuration=%v, LogBackup=%v, LogQueue=%v, LogWriters=%v, LogCompress=%v, LogBackupSize=%v, LogBackupAge=%v, LogAppend=%v, LogRotateOnStart=%v, LogLink=%v, LogLocation=%v, LogPeriod=%v, LogReopenCheck=%v, LogBuffer=%v, LogFlush=%v, LogMinFree=%v, LogMinFreeCheck=%v, LogMinFreePolicy=%v, LogFileMode=%v, LogDirMode=%v, LogOwner=%v, LogFormat=%v, LogMultiline=%v, LogMultiMarker=%q, LogCapture=%v",
+			v.LogLevel, v.LogLimit, v.LogType, v.LogFile, ByteSize(uint64(v.LogSize)), v.LogDuration, v.LogBackup, v.LogQueue, v.LogWriters, v.LogCompress, ByteSize(uint64(v.LogBackupSize)), v.LogBackupAge, v.LogAppend, v.LogRotateOnStart, v.LogLink, v.LogLocation, v.LogPeriod, v.LogReopenCheck, ByteSize(uint64(v.LogBuffer)), v.LogFlush, ByteSize(uint64(v.LogMinFree)), v.LogMinFreeCheck, v.LogMinFreePolicy, v.LogFileMode, v.LogDirMode, v.LogOwner, v.LogFormat, v.LogMultiline, v.LogMultiMarker, v.LogCapture)
 	}
 	log_debug("LOG SETUP ERRORS: %v", errs)
 }
@@ -223,44 +419,62 @@ type MessageKB_t struct {
 }
 
 func (self MessageKB_t) FormatMessage(out io.Writer, in Msg_t) (n int, err error) {
-	var b [64]byte
-	var buf strings.Builder
-
-	if self.TextLimit == 0 {
-		self.TextLimit = math.MaxInt
-	}
-
-	w := &LimitWriter_t{Buf: &buf, Limit: self.TextLimit}
-
-	buf.Reset()
-	w.Limit = self.TextLimit
+	var b [32]byte
+	enc := GetJsonEncoder()
+	defer PutJsonEncoder(enc)
 
 	if len(self.Index.Index.Format) > 0 {
-		self.Index.Index.Index = string(in.Info.Ts.AppendFormat(b[:0], self.Index.Index.Format))
-		json.NewEncoder(out).Encode(self.Index)
-	}
-
-	if strings.HasPrefix(in.Format, "json") {
-		if self.Data, err = json.Marshal(in.Args); err != nil {
-			return
+		enc.ObjectStart()
+		enc.Key("index")
+		enc.ObjectStart()
+		enc.Key("_index")
+		enc.Time(in.Info.Ts, self.Index.Index.Format)
+		if len(self.Index.Index.Type) > 0 {
+			enc.Key("_type")
+			enc.String(self.Index.Index.Type)
 		}
-	} else {
-		fmt.Fprintf(w, in.Format, in.Args...)
-		self.Message = buf.String()
+		enc.ObjectEnd()
+		enc.ObjectEnd()
+		enc.NewLine()
 	}
 
-	self.Level = fmt.Sprintf("LEVEL%v", in.Info.Level)
-	self.Timestamp = string(in.Info.Ts.AppendFormat(b[:0], "2006-01-02T15:04:05.000-07:00"))
-
-	buf.Reset()
+	enc.ObjectStart()
+	enc.Key("timestamp")
+	enc.Time(in.Info.Ts, "2006-01-02T15:04:05.000-07:00")
+	enc.Key("ApplicationName")
+	enc.String(self.ApplicationName)
+	enc.Key("Environment")
+	enc.String(self.Environment)
+	enc.Key("Level")
+	enc.Raw(append(strconv.AppendInt(append(b[:0], `"LEVEL`...), in.Info.Level, 10), '"'))
+	enc.Key("Location")
+	enc.StringStart()
 	for _, fm := range __std_parts {
-		fm.FormatMessage(&buf, in)
+		fm.FormatMessage(enc.StringWriter(), in)
 	}
-	self.Location = buf.String()
-
-	if err = json.NewEncoder(out).Encode(self); err != nil {
-		return
+	enc.StringEnd()
+	if len(self.Hostname) > 0 {
+		enc.Key("Hostname")
+		enc.String(self.Hostname)
 	}
+	if strings.HasPrefix(in.Format, "json") {
+		enc.Key("Data")
+		enc.ArrayStart()
+		for _, v := range in.Args {
+			if err = enc.Any(v); err != nil {
+				return
+			}
+		}
+		enc.ArrayEnd()
+	} else {
+		mark := enc.Len()
+		enc.Key("Message")
+		enc.Format(self.TextLimit, in.Format, in.Args...)
+		enc.OmitEmpty(mark)
+	}
+	enc.ObjectEnd()
+	enc.NewLine()
+	_, err = out.Write(enc.Bytes())
 	return
 }
 
@@ -276,13 +490,22 @@ type MessageTG_t struct {
 }
 
 func (self MessageTG_t) FormatMessage(out io.Writer, in Msg_t) (n int, err error) {
-	var buf strings.Builder
+	enc := GetJsonEncoder()
+	defer PutJsonEncoder(enc)
 
 	if self.TextLimit == 0 {
 		self.TextLimit = math.MaxInt
 	}
 
-	w := &LimitWriter_t{Buf: &buf, Limit: self.TextLimit}
+	w := &LimitWriter_t{Buf: enc.StringWriter(), Limit: self.TextLimit}
+
+	enc.ObjectStart()
+	if self.ChatId != 0 {
+		enc.Key("chat_id")
+		enc.Int(self.ChatId)
+	}
+	enc.Key("text")
+	enc.StringStart()
 
 	if len(self.Hostname) > 0 {
 		io.WriteString(w, self.Hostname)
@@ -299,15 +522,184 @@ func (self MessageTG_t) FormatMessage(out io.Writer, in Msg_t) (n int, err error
 	}
 
 	fmt.Fprintf(w, in.Format, in.Args...)
-	fmt.Fprintf(w, "\n")
+	io.WriteString(w, "\n")
+
+	enc.StringEnd()
+	enc.ObjectEnd()
+	enc.NewLine()
+	_, err = out.Write(enc.Bytes())
+	return
+}
+
+type MessageFieldSlack_t struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+type MessageAttachmentSlack_t struct {
+	Color    string                `json:"color,omitempty"`
+	Fallback string                `json:"fallback,omitempty"`
+	Title    string                `json:"title,omitempty"`
+	Text     string                `json:"text,omitempty"`
+	Fields   []MessageFieldSlack_t `json:"fields,omitempty"`
+	Ts       int64                 `json:"ts,omitempty"`
+}
+
+// Slack incoming webhook, Mattermost accepts the same payload with TextLimit 16383
+// TextLimit in characters, default 40000
+type MessageSlack_t struct {
+	Channel     string                     `json:"channel,omitempty"`
+	Username    string                     `json:"username,omitempty"`
+	Text        string                     `json:"text,omitempty"`
+	Attachments []MessageAttachmentSlack_t `json:"attachments,omitempty"`
+
+	ApplicationName string `json:"-"`
+	Hostname        string `json:"-"`
+	TextLimit       int    `json:"-"`
+}
+
+func (self MessageSlack_t) FormatMessage(out io.Writer, in Msg_t) (n int, err error) {
+	if self.TextLimit == 0 {
+		self.TextLimit = 40000
+	}
+	text := FormatRunes(self.TextLimit, in.Format, in.Args...)
+
+	attachment := MessageAttachmentSlack_t{
+		Color:    LevelColor(in.Info.Level),
+		Fallback: TruncateRunes(LevelName(in.Info.Level)+" "+text, MessageFallbackLimit),
+		Title:    strings.TrimSpace(LevelName(in.Info.Level) + " " + self.ApplicationName),
+		Text:     text,
+		Ts:       in.Info.Ts.Unix(),
+	}
+	for _, v := range MessageFields(self.Hostname, self.ApplicationName, in) {
+		attachment.Fields = append(attachment.Fields, MessageFieldSlack_t{Title: v.Key, Value: v.Value, Short: true})
+	}
+	self.Attachments = []MessageAttachmentSlack_t{attachment}
+
+	if err = json.NewEncoder(out).Encode(self); err != nil {
+		return
+	}
+	return
+}
+
+type MessageFactTeams_t struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type MessageSectionTeams_t struct {
+	Facts []MessageFactTeams_t `json:"facts,omitempty"`
+}
+
+// Microsoft Teams connector MessageCard, TextLimit in characters, default 20000
+type MessageTeams_t struct {
+	Type       string                  `json:"@type"`
+	Context    string                  `json:"@context"`
+	ThemeColor string                  `json:"themeColor,omitempty"`
+	Summary    string                  `json:"summary,omitempty"`
+	Title      string                  `json:"title,omitempty"`
+	Text       string                  `json:"text,omitempty"`
+	Sections   []MessageSectionTeams_t `json:"sections,omitempty"`
+
+	ApplicationName string `json:"-"`
+	Hostname        string `json:"-"`
+	TextLimit       int    `json:"-"`
+}
+
+func (self MessageTeams_t) FormatMessage(out io.Writer, in Msg_t) (n int, err error) {
+	if self.TextLimit == 0 {
+		self.TextLimit = 20000
+	}
+	text := FormatRunes(self.TextLimit, in.Format, in.Args...)
+
+	self.Type = "MessageCard"
+	self.Context = "http://schema.org/extensions"
+	self.ThemeColor = strings.TrimPrefix(LevelColor(in.Info.Level), "#")
+	self.Title = strings.TrimSpace(LevelName(in.Info.Level) + " " + self.ApplicationName)
+	self.Summary = self.Title
+	self.Text = text
+
+	var section MessageSectionTeams_t
+	for _, v := range MessageFields(self.Hostname, self.ApplicationName, in) {
+		section.Facts = append(section.Facts, MessageFactTeams_t{Name: v.Key, Value: v.Value})
+	}
+	self.Sections = []MessageSectionTeams_t{section}
 
-	self.Text = buf.String()
 	if err = json.NewEncoder(out).Encode(self); err != nil {
 		return
 	}
 	return
 }
 
+// Hostname, Application, Location, context id and Tags as list of fields for chat messages
+func MessageFields(hostname string, app_name string, in Msg_t) (res []Tag_t) {
+	if len(hostname) > 0 {
+		res = append(res, Tag_t{Key: "Hostname", Value: hostname})
+	}
+	if len(app_name) > 0 {
+		res = append(res, Tag_t{Key: "Application", Value: app_name})
+	}
+	res = append(res, Tag_t{Key: "Location", Value: FileLine(in.Info.File, in.Info.Line)})
+	if v := GetLogBuffer(in.Ctx); v != nil {
+		if id := v.BufferGet("id"); len(id) > 0 {
+			res = append(res, Tag_t{Key: "ContextId", Value: id})
+		}
+	}
+	for _, v := range in.Args {
+		if temp, ok := v.(Tag); ok {
+			res = append(res, Tag_t{Key: temp.TagKey(), Value: temp.TagValue()})
+		}
+	}
+	for i := range res {
+		res[i].Key = TruncateRunes(res[i].Key, MessageFieldLimit)
+		res[i].Value = TruncateRunes(res[i].Value, MessageFieldLimit)
+	}
+	return
+}
+
+// limits of fallback text and field values of chat messages in characters
+var (
+	MessageFallbackLimit = 256
+	MessageFieldLimit    = 256
+)
+
+// formatted message truncated to limit characters
+func FormatRunes(limit int, format string, args ...any) string {
+	var buf strings.Builder
+	// character takes up to 4 bytes
+	w := &LimitWriter_t{Buf: &buf, Limit: limit}
+	if limit <= math.MaxInt/4 {
+		w.Limit = 4 * limit
+	}
+	fmt.Fprintf(w, format, args...)
+	return TruncateRunes(buf.String(), limit)
+}
+
+func TruncateRunes(in string, limit int) string {
+	for i := range in {
+		if limit == 0 {
+			return in[:i]
+		}
+		limit--
+	}
+	return in
+}
+
+func LevelColor(in int64) (res string) {
+	switch in {
+	case 0, 1:
+		res = "#808080"
+	case 2:
+		res = "#36a64f"
+	case 3:
+		res = "#daa038"
+	default:
+		res = "#d00000"
+	}
+	return
+}
+
 type LimitWriter_t struct {
 	Buf   io.Writer
 	Limit int
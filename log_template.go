@@ -0,0 +1,284 @@
+//
+// Line formatter compiled from template
+//
+
+package log
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	TemplateDate   = "2006-01-02 15:04:05.000"
+	TemplateMarker = "\t"
+)
+
+type template_field_t struct {
+	name   string
+	text   string // literal text before field
+	arg    string // layout for ts, key for ctx. and tag.
+	width  int    // minimal width, negative - left aligned
+	max    int    // maximal width in runes, zero - unlimited
+	lower  bool
+	upper  bool
+	color  bool
+	multi  string
+	marker string
+	render func(b []byte, self *template_field_t, in Msg_t) []byte
+}
+
+type PartTemplate_t struct {
+	fields []template_field_t
+	tail   string
+}
+
+// "{ts:2006-01-02 15:04:05.000} {caller} [{level,-5}] {ctx.id} {msg} {tags}"
+// fields: ts[:layout], caller, file, line, level, ctx.<key> from log buffer, msg, tags, tag.<key>
+// {name,width} pads to width, negative width aligns left, {name,width.max} or {name,.max} truncates to max runes
+// {name:lower}, {name:upper}, {name:color}, {name:escape}, {name:indent}, {name:fold} - options separated by comma, {{ and }} - braces
+// options of ts follow layout after |: {ts:15:04:05|color}, {name|upper} is same as {name:upper}
+func NewPartTemplate(template string) (Formatter, error) {
+	return NewPartTemplateMultiline(template, "", TemplateMarker)
+}
+
+// multiline policy of writer is applied to {msg} without own option, marker is used by all fields with "indent"
+func NewPartTemplateMultiline(template string, multiline string, marker string) (Formatter, error) {
+	self := &PartTemplate_t{}
+	var text strings.Builder
+	for i := 0; i < len(template); i++ {
+		switch c := template[i]; {
+		case c == '{' && i+1 < len(template) && template[i+1] == '{', c == '}' && i+1 < len(template) && template[i+1] == '}':
+			text.WriteByte(c)
+			i++
+		case c == '{':
+			end := strings.IndexByte(template[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("template: unclosed field at %v", i)
+			}
+			field, err := template_field(template[i+1 : i+end])
+			if err != nil {
+				return nil, err
+			}
+			field.text = text.String()
+			field.marker = marker
+			if len(field.multi) == 0 && field.name == "msg" {
+				field.multi = multiline
+			}
+			text.Reset()
+			self.fields = append(self.fields, field)
+			i += end
+		case c == '}':
+			return nil, fmt.Errorf("template: unexpected } at %v", i)
+		default:
+			text.WriteByte(c)
+		}
+	}
+	self.tail = text.String()
+	return self, nil
+}
+
+func template_field(in string) (self template_field_t, err error) {
+	var options, layout string
+	if ix := strings.LastIndexByte(in, '|'); ix > -1 {
+		in, options = in[:ix], in[ix+1:]
+	}
+	if ix := strings.IndexByte(in, ':'); ix > -1 {
+		// layout of ts may contain ':' and ','
+		if name, _, _ := strings.Cut(in[:ix], ","); name == "ts" {
+			in, layout = in[:ix], in[ix+1:]
+		} else if len(options) == 0 {
+			in, options = in[:ix], in[ix+1:]
+		} else {
+			in, options = in[:ix], in[ix+1:]+","+options
+		}
+	}
+	if ix := strings.IndexByte(in, ','); ix > -1 {
+		var width, max string
+		in, width = in[:ix], in[ix+1:]
+		if ix = strings.IndexByte(width, '.'); ix > -1 {
+			width, max = width[:ix], width[ix+1:]
+			if self.max, err = strconv.Atoi(max); err != nil || self.max < 0 {
+				return self, fmt.Errorf("template: %v: bad max %q", in, max)
+			}
+		}
+		if len(width) > 0 {
+			if self.width, err = strconv.Atoi(width); err != nil {
+				return self, fmt.Errorf("template: %v: bad width %q", in, width)
+			}
+		}
+	}
+	self.name = in
+	switch {
+	case in == "ts":
+		self.render = render_ts
+		if self.arg = layout; len(self.arg) == 0 {
+			self.arg = TemplateDate
+		}
+	case in == "caller":
+		self.render = render_caller
+	case in == "file":
+		self.render = render_file
+	case in == "line":
+		self.render = render_line
+	case in == "level":
+		self.render = render_level
+	case in == "msg":
+		self.render = render_msg
+	case in == "tags":
+		self.render = render_tags
+	case strings.HasPrefix(in, "ctx."):
+		self.arg = in[len("ctx."):]
+		self.render = render_ctx
+	case strings.HasPrefix(in, "tag."):
+		self.arg = in[len("tag."):]
+		self.render = render_tag
+	default:
+		return self, fmt.Errorf("template: unknown field %q", in)
+	}
+	for _, v := range strings.Split(options, ",") {
+		switch v {
+		case "":
+		case "lower":
+			self.lower = true
+		case "upper":
+			self.upper = true
+		case "color":
+			self.color = true
+		case "escape", "indent", "fold":
+			self.multi = v
+		default:
+			return self, fmt.Errorf("template: %v: unknown option %q", in, v)
+		}
+	}
+	return
+}
+
+func (self *PartTemplate_t) FormatMessage(out io.Writer, in Msg_t) (n int, err error) {
+	var temp [512]byte
+	b := temp[:0]
+	for i := range self.fields {
+		b = append(b, self.fields[i].text...)
+		b = self.fields[i].format(b, in)
+	}
+	b = append(b, self.tail...)
+	return out.Write(b)
+}
+
+func (self *template_field_t) format(b []byte, in Msg_t) []byte {
+	start := len(b)
+	if self.color {
+		b = append(b, LevelAnsi(in.Info.Level)...)
+	}
+	value := len(b)
+	b = self.render(b, self, in)
+	if len(self.multi) > 0 {
+		var temp [512]byte
+		b = AppendMultiline(b[:value], append(temp[:0], b[value:]...), self.multi, self.marker)
+	}
+	if self.max > 0 {
+		for i, count := value, 0; i < len(b); count++ {
+			if count == self.max {
+				b = b[:i]
+				break
+			}
+			_, size := utf8.DecodeRune(b[i:])
+			i += size
+		}
+	}
+	if self.lower || self.upper {
+		var s string
+		if self.lower {
+			s = strings.ToLower(string(b[value:]))
+		} else {
+			s = strings.ToUpper(string(b[value:]))
+		}
+		b = append(b[:value], s...)
+	}
+	if pad := abs(self.width) - utf8.RuneCount(b[value:]); pad > 0 {
+		n := len(b)
+		for i := 0; i < pad; i++ {
+			b = append(b, ' ')
+		}
+		if self.width > 0 {
+			copy(b[value+pad:], b[value:n])
+			for i := value; i < value+pad; i++ {
+				b[i] = ' '
+			}
+		}
+	}
+	if self.color {
+		if len(b) == value {
+			return b[:start]
+		}
+		b = append(b, ColorReset...)
+	}
+	return b
+}
+
+func abs(in int) int {
+	if in < 0 {
+		return -in
+	}
+	return in
+}
+
+func render_ts(b []byte, self *template_field_t, in Msg_t) []byte {
+	return in.Info.Ts.AppendFormat(b, self.arg)
+}
+
+func render_caller(b []byte, self *template_field_t, in Msg_t) []byte {
+	return append(b, FileLine(in.Info.File, in.Info.Line)...)
+}
+
+func render_file(b []byte, self *template_field_t, in Msg_t) []byte {
+	file := FileLine(in.Info.File, in.Info.Line)
+	return append(b, file[:strings.LastIndexByte(file, ':')]...)
+}
+
+func render_line(b []byte, self *template_field_t, in Msg_t) []byte {
+	return strconv.AppendInt(b, int64(in.Info.Line), 10)
+}
+
+func render_level(b []byte, self *template_field_t, in Msg_t) []byte {
+	return append(b, LevelName(in.Info.Level)...)
+}
+
+func render_msg(b []byte, self *template_field_t, in Msg_t) []byte {
+	return fmt.Appendf(b, in.Format, in.Args...)
+}
+
+func render_ctx(b []byte, self *template_field_t, in Msg_t) []byte {
+	if v := GetLogBuffer(in.Ctx); v != nil {
+		b = append(b, v.BufferGet(self.arg)...)
+	}
+	return b
+}
+
+func render_tags(b []byte, self *template_field_t, in Msg_t) []byte {
+	var next bool
+	for _, v := range in.Args {
+		if temp, ok := v.(Tag); ok {
+			if next {
+				b = append(b, ' ')
+			}
+			next = true
+			b = append(b, temp.TagKey()...)
+			b = append(b, '=')
+			b = append(b, temp.TagValue()...)
+		}
+	}
+	return b
+}
+
+func render_tag(b []byte, self *template_field_t, in Msg_t) []byte {
+	for _, v := range in.Args {
+		if temp, ok := v.(Tag); ok && temp.TagKey() == self.arg {
+			return append(b, temp.TagValue()...)
+		}
+	}
+	return b
+}
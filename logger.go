@@ -37,6 +37,10 @@ type QueueSize_t struct {
 	QueueOverflow int
 	WriteErrorCnt int
 	WriteErrorMsg string
+	Connected     bool
+	Reconnect     int
+	WriteBytes    int
+	SyncLatency   time.Duration
 }
 
 type Queue interface {
@@ -0,0 +1,643 @@
+//
+// Options shared by file writers
+//
+
+package log
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type FileOptions_t struct {
+	compress        string
+	max_total       int64
+	max_age         time.Duration
+	append          bool
+	rotate_on_start bool
+	location        *time.Location
+	period          string
+	reopen_check    time.Duration
+	last_check      time.Time
+	buffer_size     int
+	flush_interval  time.Duration
+	stats           FileStats_t
+	min_free        int64
+	free_check      time.Duration
+	free_policy     string
+	free_last       time.Time
+	free_low        bool
+	file_mode       os.FileMode
+	dir_mode        os.FileMode
+	uid             int
+	gid             int
+	compressing     *compressing_t
+}
+
+// background compressions by name of compressed file, false - backup removed before compression finished
+type compressing_t struct {
+	mx   sync.Mutex
+	jobs map[string]bool
+}
+
+// messages below this level are dropped by "drop" policy when disk space is low
+var FileDropLevel int64 = 3
+
+type FileStats_t struct {
+	write_bytes  int
+	sync_latency int64 // atomic, file is synced outside of writer lock
+}
+
+// log file with optional write buffer, counts bytes written by formatters
+type FileOut_t struct {
+	*os.File
+	buf   *bufio.Writer
+	stats *FileStats_t
+	bytes int
+}
+
+func (self *FileOut_t) Write(p []byte) (n int, err error) {
+	if self.buf != nil {
+		n, err = self.buf.Write(p)
+	} else {
+		n, err = self.File.Write(p)
+	}
+	self.bytes += n
+	self.stats.write_bytes += n
+	return
+}
+
+// size of file including appended content
+func (self *FileOut_t) Bytes() int {
+	if self == nil {
+		return 0
+	}
+	return self.bytes
+}
+
+// writes buffer to file if not empty
+func (self *FileOut_t) Flush() (err error) {
+	if self.buf != nil && self.buf.Buffered() > 0 {
+		err = self.buf.Flush()
+	}
+	return
+}
+
+// flushes buffer and commits file to disk
+func (self *FileOut_t) Sync() (err error) {
+	if err = self.Flush(); err != nil {
+		return
+	}
+	ts := time.Now()
+	err = self.File.Sync()
+	atomic.StoreInt64(&self.stats.sync_latency, int64(time.Since(ts)))
+	return
+}
+
+func (self *FileOut_t) Close() (err error) {
+	self.Flush()
+	return self.File.Close()
+}
+
+type FileOption func(self *FileOptions_t)
+
+// "gzip" or "zstd", rotated files are compressed in background
+func FileCompress(format string) FileOption {
+	return func(self *FileOptions_t) {
+		self.compress = format
+	}
+}
+
+// oldest backups are removed while total size of backups exceeds max_total
+func FileMaxTotal(max_total int64) FileOption {
+	return func(self *FileOptions_t) {
+		self.max_total = max_total
+	}
+}
+
+// backups modified before max_age are removed
+func FileMaxAge(max_age time.Duration) FileOption {
+	return func(self *FileOptions_t) {
+		self.max_age = max_age
+	}
+}
+
+// existing log file is appended instead of truncated
+func FileAppend() FileOption {
+	return func(self *FileOptions_t) {
+		self.append = true
+	}
+}
+
+// existing non-empty log file is moved to backups on start, it is not truncated without FileAppend
+func FileRotateOnStart() FileOption {
+	return func(self *FileOptions_t) {
+		self.rotate_on_start = true
+	}
+}
+
+// rotation boundaries are computed in location instead of UTC
+func FileLocation(location *time.Location) FileOption {
+	return func(self *FileOptions_t) {
+		self.location = location
+	}
+}
+
+// "hourly", "daily", "weekly" (from Monday), "monthly" - calendar periods in location, overrides duration
+func FilePeriod(period string) FileOption {
+	return func(self *FileOptions_t) {
+		self.period = period
+	}
+}
+
+// log file is reopened if moved, deleted or truncated by logrotate, checked not more often than interval
+func FileReopenCheck(interval time.Duration) FileOption {
+	return func(self *FileOptions_t) {
+		self.reopen_check = interval
+	}
+}
+
+// buffer_size > 0 enables write buffer, buffer is flushed every flush_interval if not empty
+// file is synced on rotate and Close
+func FileBuffer(buffer_size int, flush_interval time.Duration) FileOption {
+	return func(self *FileOptions_t) {
+		self.buffer_size = buffer_size
+		self.flush_interval = flush_interval
+	}
+}
+
+// free space on file system of log file is checked every interval, policy when free space below min_free:
+// "drop" - messages below FileDropLevel are dropped, "backups" - oldest backups are removed, "stderr" - messages are written to stderr
+func FileMinFree(min_free int64, interval time.Duration, policy string) FileOption {
+	return func(self *FileOptions_t) {
+		self.min_free = min_free
+		self.free_check = interval
+		self.free_policy = policy
+	}
+}
+
+// permissions of log files and compressed backups are set to mode ignoring umask, default 0644 with umask applied
+func FileMode(mode os.FileMode) FileOption {
+	return func(self *FileOptions_t) {
+		self.file_mode = mode
+	}
+}
+
+// missing directories of log file are created with mode
+func FileDirMode(mode os.FileMode) FileOption {
+	return func(self *FileOptions_t) {
+		self.dir_mode = mode
+	}
+}
+
+// log files and compressed backups are chowned to uid and gid, -1 keeps value unchanged
+func FileOwner(uid int, gid int) FileOption {
+	return func(self *FileOptions_t) {
+		self.uid = uid
+		self.gid = gid
+	}
+}
+
+func NewFileOptions(opts ...FileOption) (self FileOptions_t) {
+	self.uid = -1
+	self.gid = -1
+	self.compressing = &compressing_t{jobs: map[string]bool{}}
+	for _, opt := range opts {
+		opt(&self)
+	}
+	return
+}
+
+func CompressExt(format string) string {
+	switch format {
+	case "gzip":
+		return ".gz"
+	case "zstd":
+		return ".zst"
+	}
+	return ""
+}
+
+// start of rotation period containing ts
+// without location and period it is ts.Truncate(truncate) relative to zero time in UTC
+func (self *FileOptions_t) Period(ts time.Time, truncate time.Duration) time.Time {
+	if self.location == nil && len(self.period) == 0 {
+		return ts.Truncate(truncate)
+	}
+	loc := self.location
+	if loc == nil {
+		loc = time.Local
+	}
+	t := ts.In(loc)
+	year, month, day := t.Date()
+	switch {
+	case self.period == "monthly":
+		return time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	case self.period == "weekly" || len(self.period) == 0 && truncate == 7*24*time.Hour:
+		return time.Date(year, month, day-(int(t.Weekday())+6)%7, 0, 0, 0, 0, loc)
+	case self.period == "daily" || len(self.period) == 0 && truncate == 24*time.Hour:
+		return time.Date(year, month, day, 0, 0, 0, 0, loc)
+	case self.period == "hourly":
+		truncate = time.Hour
+	}
+	// absolute time for parts of hour, repeated hour on DST change is not merged
+	if truncate > 0 && time.Hour%truncate == 0 {
+		part := time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+		return t.Add(-(part % truncate))
+	}
+	// wall clock for parts of day
+	if truncate > 0 && 24*time.Hour%truncate == 0 {
+		seconds := t.Hour()*3600 + t.Minute()*60 + t.Second()
+		return time.Date(year, month, day, 0, 0, seconds-seconds%int(truncate/time.Second), 0, loc)
+	}
+	return t.Truncate(truncate)
+}
+
+// opens log file
+func (self *FileOptions_t) Open(filename string) (out *FileOut_t, err error) {
+	if self.append {
+		return self.Reopen(filename)
+	}
+	return self.open(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+}
+
+// opens log file after external rotation, existing file is never truncated
+func (self *FileOptions_t) Reopen(filename string) (out *FileOut_t, err error) {
+	return self.open(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND)
+}
+
+func (self *FileOptions_t) open(filename string, flags int) (out *FileOut_t, err error) {
+	if self.dir_mode != 0 {
+		if err = os.MkdirAll(filepath.Dir(filename), self.dir_mode); err != nil {
+			return
+		}
+	}
+	file, err := self.create(filename, flags)
+	if err != nil {
+		return
+	}
+	out = &FileOut_t{File: file, stats: &self.stats}
+	if self.buffer_size > 0 {
+		out.buf = bufio.NewWriterSize(file, self.buffer_size)
+	}
+	if flags&os.O_APPEND != 0 {
+		if info, e := file.Stat(); e == nil {
+			out.bytes = int(info.Size())
+		}
+	}
+	return
+}
+
+// mode is set explicitly only if FileMode is given, because OpenFile applies umask
+func (self *FileOptions_t) create(filename string, flags int) (file *os.File, err error) {
+	if self.file_mode == 0 {
+		file, err = os.OpenFile(filename, flags, 0644)
+	} else {
+		file, err = os.OpenFile(filename, flags, self.file_mode)
+	}
+	if err != nil {
+		return
+	}
+	if self.file_mode != 0 {
+		err = file.Chmod(self.file_mode)
+	}
+	if err == nil && (self.uid >= 0 || self.gid >= 0) {
+		err = file.Chown(self.uid, self.gid)
+	}
+	if err != nil {
+		file.Close()
+		file = nil
+	}
+	return
+}
+
+// calls flush every flush_interval until done is closed
+func (self *FileOptions_t) Flusher(wg *sync.WaitGroup, mx sync.Locker, flush func()) (done chan struct{}) {
+	if self.buffer_size <= 0 || self.flush_interval <= 0 {
+		return
+	}
+	done = make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		tick := time.NewTicker(self.flush_interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-tick.C:
+				mx.Lock()
+				flush()
+				mx.Unlock()
+			}
+		}
+	}()
+	return
+}
+
+func (self *FileOptions_t) Stats(res *QueueSize_t) {
+	res.WriteBytes = self.stats.write_bytes
+	res.SyncLatency = time.Duration(atomic.LoadInt64(&self.stats.sync_latency))
+}
+
+// flushes buffer of rotated file, file is synced and closed in background outside of writer lock
+func (self *FileOptions_t) Release(wg *sync.WaitGroup, out *FileOut_t) {
+	out.Flush()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		out.Sync()
+		out.File.Close()
+	}()
+}
+
+// flushes buffer, syncs and closes file, called after writer lock is released
+func (self *FileOptions_t) Close(out *FileOut_t) (err error) {
+	if out == nil {
+		return
+	}
+	err = out.Sync()
+	if e := out.Close(); e != nil {
+		err = e
+	}
+	return
+}
+
+// writer of log file failed to open
+type closed_writer_t struct{}
+
+func (closed_writer_t) Write(p []byte) (int, error) {
+	return 0, os.ErrInvalid
+}
+
+// returns output for message: out, os.Stderr or nil if message should be dropped
+// change of free space state is reported once through logger
+func (self *FileOptions_t) DiskGuard(ts time.Time, level int64, filename string, files *[]string, out *FileOut_t) io.Writer {
+	var res io.Writer = closed_writer_t{}
+	if out != nil {
+		res = out
+	}
+	if self.min_free <= 0 {
+		return res
+	}
+	if ts.Sub(self.free_last) >= self.free_check {
+		self.free_last = ts
+		if free, err := DiskFree(filepath.Dir(filename)); err == nil {
+			for free < self.min_free && self.free_policy == "backups" && len(*files) > 0 {
+				self.Remove((*files)[0])
+				*files = (*files)[1:]
+				free, _ = DiskFree(filepath.Dir(filename))
+			}
+			if low := free < self.min_free; low != self.free_low {
+				self.free_low = low
+				// writer is locked, log asynchronously
+				if low {
+					go GetLogger().Error("LOG DISK SPACE LOW: %v, free=%v, min_free=%v, policy=%v", filename, ByteSize(uint64(free)), ByteSize(uint64(self.min_free)), self.free_policy)
+				} else {
+					go GetLogger().Info("LOG DISK SPACE OK: %v, free=%v, min_free=%v", filename, ByteSize(uint64(free)), ByteSize(uint64(self.min_free)))
+				}
+			}
+		}
+	}
+	if !self.free_low {
+		return res
+	}
+	switch self.free_policy {
+	case "drop":
+		if level < FileDropLevel {
+			return nil
+		}
+	case "stderr":
+		return os.Stderr
+	}
+	return res
+}
+
+// reports true if filename moved, deleted or truncated since out was opened
+func (self *FileOptions_t) Moved(ts time.Time, out *FileOut_t, filename string) bool {
+	if self.reopen_check == 0 || out == nil || ts.Sub(self.last_check) < self.reopen_check {
+		return false
+	}
+	self.last_check = ts
+	info1, err := os.Stat(filename)
+	if err != nil {
+		return true
+	}
+	info2, err := out.Stat()
+	if err != nil {
+		return true
+	}
+	if !os.SameFile(info1, info2) {
+		return true
+	}
+	// copytruncate
+	offset, err := out.Seek(0, io.SeekCurrent)
+	return err == nil && offset > info1.Size()
+}
+
+// start of period of existing non-empty log file opened by FileAppend, file from previous period is rotated by first message
+func (self *FileOptions_t) Appended(filename string, truncate time.Duration) (ts time.Time, ok bool) {
+	if !self.append {
+		return
+	}
+	if info, err := os.Stat(filename); err == nil && info.Size() > 0 {
+		return self.Period(info.ModTime(), truncate), true
+	}
+	return
+}
+
+// modification time of existing non-empty log file to be moved to backups on start
+func (self *FileOptions_t) RotateOnStart(filename string) (ts time.Time, ok bool) {
+	if !self.rotate_on_start {
+		return
+	}
+	if info, err := os.Stat(filename); err == nil && info.Size() > 0 {
+		return info.ModTime(), true
+	}
+	return
+}
+
+// returns name of backup file in the list of backups, compression is started in background
+func (self *FileOptions_t) Backup(wg *sync.WaitGroup, filename string) string {
+	ext := CompressExt(self.compress)
+	if len(ext) == 0 {
+		return filename
+	}
+	self.compressing.mx.Lock()
+	self.compressing.jobs[filename+ext] = true
+	self.compressing.mx.Unlock()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := self.CompressFile(filename, filename+ext)
+		self.compressing.mx.Lock()
+		keep := self.compressing.jobs[filename+ext]
+		delete(self.compressing.jobs, filename+ext)
+		self.compressing.mx.Unlock()
+		if err != nil && keep {
+			LogStderr("LOG COMPRESS: %v %v", filename, err)
+		}
+	}()
+	return filename + ext
+}
+
+// removes backup file, uncompressed file is removed too if compression not finished
+// compression in progress is cancelled
+func (self *FileOptions_t) Remove(filename string) {
+	self.compressing.mx.Lock()
+	defer self.compressing.mx.Unlock()
+	if _, ok := self.compressing.jobs[filename]; ok {
+		self.compressing.jobs[filename] = false
+	}
+	os.Remove(filename)
+	if ext := CompressExt(self.compress); len(ext) > 0 && strings.HasSuffix(filename, ext) {
+		os.Remove(filename[:len(filename)-len(ext)])
+	}
+}
+
+// removes oldest backups over backup_count, max_total and max_age limits
+func (self *FileOptions_t) Retention(ts time.Time, files []string, backup_count int) []string {
+	for len(files) > backup_count {
+		self.Remove(files[0])
+		files = files[1:]
+	}
+	if self.max_total == 0 && self.max_age == 0 {
+		return files
+	}
+	var expired int
+	var total int64
+	sizes := make([]int64, len(files))
+	for i, v := range files {
+		if info, err := self.stat(v); err == nil {
+			sizes[i] = info.Size()
+			total += info.Size()
+			if self.max_age > 0 && ts.Sub(info.ModTime()) > self.max_age {
+				expired = i + 1
+			}
+		}
+	}
+	for len(files) > 0 && (expired > 0 || self.max_total > 0 && total > self.max_total) {
+		self.Remove(files[0])
+		total -= sizes[0]
+		files, sizes = files[1:], sizes[1:]
+		expired--
+	}
+	return files
+}
+
+// backup may be not compressed yet
+func (self *FileOptions_t) stat(filename string) (info os.FileInfo, err error) {
+	if info, err = os.Stat(filename); err != nil {
+		if ext := CompressExt(self.compress); len(ext) > 0 && strings.HasSuffix(filename, ext) {
+			info, err = os.Stat(filename[:len(filename)-len(ext)])
+		}
+	}
+	return
+}
+
+// backups of filename "%s.%d.%s" sorted by cycle, uncompressed backups are compressed
+func (self *FileOptions_t) Backups(wg *sync.WaitGroup, filename string) (files []string, cycle int, err error) {
+	dir, base := filepath.Split(filename)
+	entries, err := os.ReadDir(filepath.Clean(dir + "."))
+	if err != nil {
+		// directory is created on open
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	type backup_t struct {
+		name  string
+		cycle int
+	}
+	var backups []backup_t
+	for _, v := range entries {
+		name, ok := strings.CutPrefix(v.Name(), base+".")
+		if !ok || v.IsDir() || strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+		ix := strings.IndexByte(name, '.')
+		if ix < 1 {
+			continue
+		}
+		n, e := strconv.Atoi(name[:ix])
+		if e != nil {
+			continue
+		}
+		backups = append(backups, backup_t{name: v.Name(), cycle: n})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].cycle < backups[j].cycle })
+	for _, v := range backups {
+		name := filepath.Join(dir, v.name)
+		if ext := filepath.Ext(name); ext != CompressExt("gzip") && ext != CompressExt("zstd") {
+			name = self.Backup(wg, name)
+		}
+		files = append(files, name)
+		cycle = v.cycle
+	}
+	return
+}
+
+// in is removed after successful compression
+func CompressFile(in string, out string, format string) (err error) {
+	options := NewFileOptions(FileCompress(format))
+	return options.CompressFile(in, out)
+}
+
+// out is created with mode and owner of log files
+// if out was removed by Remove while compressing, compressed file is dropped
+func (self *FileOptions_t) CompressFile(in string, out string) (err error) {
+	src, err := os.Open(in)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	dst, err := self.create(out+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return
+	}
+	defer os.Remove(out + ".tmp")
+	var w io.WriteCloser
+	switch self.compress {
+	case "zstd":
+		if w, err = zstd.NewWriter(dst); err != nil {
+			dst.Close()
+			return
+		}
+	default:
+		w = gzip.NewWriter(dst)
+	}
+	if _, err = io.Copy(w, src); err != nil {
+		w.Close()
+		dst.Close()
+		return
+	}
+	if err = w.Close(); err != nil {
+		dst.Close()
+		return
+	}
+	if err = dst.Close(); err != nil {
+		return
+	}
+	self.compressing.mx.Lock()
+	defer self.compressing.mx.Unlock()
+	if keep, ok := self.compressing.jobs[out]; ok && !keep {
+		return
+	}
+	if err = os.Rename(out+".tmp", out); err != nil {
+		return
+	}
+	return os.Remove(in)
+}
@@ -0,0 +1,12 @@
+//go:build !(linux || darwin || freebsd)
+
+package log
+
+import "errors"
+
+var ERROR_STATFS = errors.New("STATFS NOT SUPPORTED")
+
+// free space check is disabled on this platform
+func DiskFree(path string) (free int64, err error) {
+	return 0, ERROR_STATFS
+}
@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd
+
+package log
+
+import "syscall"
+
+// free space available to unprivileged user on file system of path
+func DiskFree(path string) (free int64, err error) {
+	var st syscall.Statfs_t
+	if err = syscall.Statfs(path, &st); err != nil {
+		return
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
@@ -0,0 +1,325 @@
+//
+// Log rotator by size and time with file names from template
+//
+
+package log
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type WriterFileRotate_t struct {
+	mx              sync.Mutex
+	wg              sync.WaitGroup
+	last_date       time.Time
+	prefix          []Formatter
+	out             *FileOut_t
+	done            chan struct{}
+	template        string
+	link            string
+	filename        string
+	files           []string
+	bytes_limit     int
+	truncate        time.Duration
+	backup_count    int
+	index           int
+	log_limit       int
+	queue_write     int
+	write_error_cnt int
+	write_error_msg string
+	options         FileOptions_t
+}
+
+// template: app-%Y%m%d-%H.%i.log.gz
+// %Y %m %d %H %M %S - period start, %i - index of file in period, %% - percent sign
+// .gz or .zst at the end of template enables compression of rotated files
+// rotation happens on whichever comes first: bytes_limit or truncate period, zero disables limit
+// link: symlink to active file, empty - no symlink
+func NewWriterFileRotate(ts time.Time, template string, link string, prefix []Formatter, bytes_limit int, truncate time.Duration, backup_count int, log_limit int, opts ...FileOption) (Queue, error) {
+	self := &WriterFileRotate_t{
+		prefix:       prefix,
+		template:     template,
+		link:         link,
+		bytes_limit:  bytes_limit,
+		truncate:     truncate,
+		backup_count: backup_count,
+		log_limit:    log_limit,
+		options:      NewFileOptions(opts...),
+	}
+	for _, v := range []string{"gzip", "zstd"} {
+		if ext := CompressExt(v); strings.HasSuffix(self.template, ext) {
+			self.template = strings.TrimSuffix(self.template, ext)
+			if len(self.options.compress) == 0 {
+				self.options.compress = v
+			}
+		}
+	}
+	if !strings.Contains(self.template, "%i") {
+		self.template += ".%i"
+	}
+	self.last_date = self.period(ts)
+	var err error
+	if self.files, err = self.backups(); err != nil {
+		return self, err
+	}
+	if err = self.__cycle(ts); err != nil {
+		return self, err
+	}
+	self.done = self.options.Flusher(&self.wg, &self.mx, func() {
+		if self.out != nil {
+			self.out.Flush()
+		}
+	})
+	return self, nil
+}
+
+func (self *WriterFileRotate_t) period(ts time.Time) time.Time {
+	if self.truncate > 0 || len(self.options.period) > 0 {
+		return self.options.Period(ts, self.truncate)
+	}
+	return time.Time{}
+}
+
+func (self *WriterFileRotate_t) LogWrite(msg []Msg_t) (n int, err error) {
+	self.mx.Lock()
+	defer self.mx.Unlock()
+	for _, m := range msg {
+		self.queue_write++
+		if self.options.Moved(m.Info.Ts, self.out, self.filename) {
+			self.__reopen()
+		}
+		if tr := self.period(m.Info.Ts); !self.last_date.Equal(tr) {
+			self.last_date = tr
+			self.index = 0
+			self.__cycle(m.Info.Ts)
+		}
+		out := self.options.DiskGuard(m.Info.Ts, m.Info.Level, self.filename, &self.files, self.out)
+		if out == nil {
+			continue
+		}
+		var w io.Writer
+		if self.log_limit > 0 {
+			w = &LimitWriter_t{Buf: out, Limit: self.log_limit}
+		} else {
+			w = out
+		}
+		for _, v := range self.prefix {
+			if n, err = v.FormatMessage(w, m); err != nil {
+				self.write_error_cnt++
+				self.write_error_msg = err.Error()
+				return
+			}
+		}
+		if self.bytes_limit > 0 && self.out.Bytes() >= self.bytes_limit {
+			self.index++
+			self.__cycle(m.Info.Ts)
+		}
+	}
+	return
+}
+
+func (self *WriterFileRotate_t) Size() (res QueueSize_t) {
+	self.mx.Lock()
+	res.QueueWrite = self.queue_write
+	res.WriteErrorCnt = self.write_error_cnt
+	res.WriteErrorMsg = self.write_error_msg
+	self.options.Stats(&res)
+	self.mx.Unlock()
+	return
+}
+
+func (self *WriterFileRotate_t) Close() (err error) {
+	self.mx.Lock()
+	out := self.out
+	self.out = nil
+	if self.done != nil {
+		close(self.done)
+		self.done = nil
+	}
+	self.mx.Unlock()
+	err = self.options.Close(out)
+	self.wg.Wait()
+	return
+}
+
+// reopens log file after external rotation
+func (self *WriterFileRotate_t) Reopen() (err error) {
+	self.mx.Lock()
+	defer self.mx.Unlock()
+	return self.__reopen()
+}
+
+func (self *WriterFileRotate_t) __reopen() (err error) {
+	if self.out != nil {
+		self.out.Close()
+	}
+	self.out, err = self.options.Reopen(self.filename)
+	return
+}
+
+func (self *WriterFileRotate_t) __cycle(ts time.Time) (err error) {
+	if self.out != nil {
+		self.options.Release(&self.wg, self.out)
+		if self.out.Bytes() == 0 {
+			os.Remove(self.filename)
+		} else {
+			self.files = append(self.files, self.options.Backup(&self.wg, self.filename))
+		}
+	}
+	self.files = self.options.Retention(ts, self.files, self.backup_count)
+	self.filename = FormatFileName(self.template, self.last_date, self.index)
+	if self.out, err = self.options.Open(self.filename); err != nil {
+		return
+	}
+	if len(self.link) > 0 {
+		target, e := filepath.Rel(filepath.Dir(self.link), self.filename)
+		if e != nil {
+			target, _ = filepath.Abs(self.filename)
+		}
+		os.Remove(self.link + ".tmp")
+		if err = os.Symlink(target, self.link+".tmp"); err != nil {
+			return
+		}
+		err = os.Rename(self.link+".tmp", self.link)
+	}
+	return
+}
+
+// finds existing files by template, selects index of active file in current period
+func (self *WriterFileRotate_t) backups() (files []string, err error) {
+	dir, base := filepath.Split(self.template)
+	entries, err := os.ReadDir(filepath.Clean(dir + "."))
+	if err != nil {
+		// directory is created on open
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	re, verbs := FileNameRegexp(base)
+	type backup_t struct {
+		name string
+		key  []int
+	}
+	var backups []backup_t
+	for _, v := range entries {
+		match := re.FindStringSubmatch(v.Name())
+		if match == nil || v.IsDir() {
+			continue
+		}
+		// sort key: year, month, day, hour, minute, second, index
+		key := make([]int, 7)
+		for i, verb := range verbs {
+			key[strings.IndexByte("YmdHMSi", verb)], _ = strconv.Atoi(match[i+1])
+		}
+		backups = append(backups, backup_t{name: filepath.Join(dir, v.Name()), key: key})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		for k := range backups[i].key {
+			if backups[i].key[k] != backups[j].key[k] {
+				return backups[i].key[k] < backups[j].key[k]
+			}
+		}
+		return backups[i].name < backups[j].name
+	})
+
+	exists := map[string]bool{}
+	for _, v := range backups {
+		exists[v.name] = true
+	}
+	name := func(index int) string {
+		return filepath.Clean(FormatFileName(self.template, self.last_date, index))
+	}
+	ext := CompressExt(self.options.compress)
+	for exists[name(self.index)] || exists[name(self.index)+ext] {
+		self.index++
+	}
+	// active file is reopened
+	if self.options.append && !self.options.rotate_on_start && self.index > 0 && exists[name(self.index-1)] {
+		self.index--
+	}
+
+	active := name(self.index)
+	for _, v := range backups {
+		if v.name == active {
+			continue
+		}
+		if filepath.Ext(v.name) != CompressExt("gzip") && filepath.Ext(v.name) != CompressExt("zstd") {
+			v.name = self.options.Backup(&self.wg, v.name)
+		}
+		files = append(files, v.name)
+	}
+	return
+}
+
+// %Y %m %d %H %M %S - time, %i - index, %% - percent sign
+func FormatFileName(template string, ts time.Time, index int) string {
+	var b []byte
+	var buf [16]byte
+	for i := 0; i < len(template); i++ {
+		if template[i] != '%' || i+1 == len(template) {
+			b = append(b, template[i])
+			continue
+		}
+		i++
+		switch template[i] {
+		case 'Y':
+			b = ts.AppendFormat(b, "2006")
+		case 'm':
+			b = ts.AppendFormat(b, "01")
+		case 'd':
+			b = ts.AppendFormat(b, "02")
+		case 'H':
+			b = ts.AppendFormat(b, "15")
+		case 'M':
+			b = ts.AppendFormat(b, "04")
+		case 'S':
+			b = ts.AppendFormat(b, "05")
+		case 'i':
+			b = append(b, strconv.AppendInt(buf[:0], int64(index), 10)...)
+		case '%':
+			b = append(b, '%')
+		default:
+			b = append(b, '%', template[i])
+		}
+	}
+	return string(b)
+}
+
+// regexp matching file names from template with optional compression extension, verbs in order of groups
+func FileNameRegexp(template string) (re *regexp.Regexp, verbs []byte) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(template); i++ {
+		if template[i] != '%' || i+1 == len(template) {
+			b.WriteString(regexp.QuoteMeta(template[i : i+1]))
+			continue
+		}
+		i++
+		switch template[i] {
+		case 'Y':
+			b.WriteString(`(\d{4})`)
+		case 'm', 'd', 'H', 'M', 'S':
+			b.WriteString(`(\d{2})`)
+		case 'i':
+			b.WriteString(`(\d+)`)
+		case '%':
+			b.WriteString("%")
+			continue
+		default:
+			b.WriteString(regexp.QuoteMeta(template[i-1 : i+1]))
+			continue
+		}
+		verbs = append(verbs, template[i])
+	}
+	b.WriteString(`(?:\.gz|\.zst)?$`)
+	return regexp.MustCompile(b.String()), verbs
+}
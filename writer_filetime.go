@@ -16,9 +16,11 @@ var FileTime = "20060102150405"
 
 type WriterFileTime_t struct {
 	mx              sync.Mutex
+	wg              sync.WaitGroup
 	last_date       time.Time
 	prefix          []Formatter
-	out             *os.File
+	out             *FileOut_t
+	done            chan struct{}
 	filename        string
 	files           []string
 	truncate        time.Duration
@@ -29,18 +31,43 @@ type WriterFileTime_t struct {
 	write_error_cnt int
 	write_error_msg string
 	bulk_write      int
+	options         FileOptions_t
 }
 
-func NewWriterFileTime(ts time.Time, filename string, prefix []Formatter, truncate time.Duration, backup_count int, log_limit int) (Queue, error) {
+func NewWriterFileTime(ts time.Time, filename string, prefix []Formatter, truncate time.Duration, backup_count int, log_limit int, opts ...FileOption) (Queue, error) {
 	self := &WriterFileTime_t{
 		prefix:       prefix,
 		filename:     filename,
 		truncate:     truncate,
 		backup_count: backup_count,
-		last_date:    ts,
 		log_limit:    log_limit,
+		options:      NewFileOptions(opts...),
 	}
-	return self, self.__cycle(self.last_date)
+	self.last_date = self.options.Period(ts, truncate)
+	var err error
+	if self.files, self.cycle, err = self.options.Backups(&self.wg, filename); err != nil {
+		return self, err
+	}
+	if start, ok := self.options.RotateOnStart(filename); ok {
+		// existing file is reopened and moved to backups by cycle
+		if self.out, err = self.options.Reopen(filename); err == nil {
+			err = self.__cycle(start)
+		}
+	} else {
+		if last, ok := self.options.Appended(filename, truncate); ok {
+			self.last_date = last
+		}
+		err = self.__cycle(ts)
+	}
+	if err != nil {
+		return self, err
+	}
+	self.done = self.options.Flusher(&self.wg, &self.mx, func() {
+		if self.out != nil {
+			self.out.Flush()
+		}
+	})
+	return self, nil
 }
 
 func (self *WriterFileTime_t) LogWrite(msg []Msg_t) (n int, err error) {
@@ -48,16 +75,23 @@ func (self *WriterFileTime_t) LogWrite(msg []Msg_t) (n int, err error) {
 	defer self.mx.Unlock()
 	for _, m := range msg {
 		self.queue_write++
-		var w io.Writer
-		if self.log_limit > 0 {
-			w = &LimitWriter_t{Buf: self.out, Limit: self.log_limit}
-		} else {
-			w = self.out
+		if self.options.Moved(m.Info.Ts, self.out, self.filename) {
+			self.__reopen()
 		}
-		if tr := m.Info.Ts.Truncate(self.truncate); !self.last_date.Equal(tr) {
+		if tr := self.options.Period(m.Info.Ts, self.truncate); !self.last_date.Equal(tr) {
 			self.__cycle(m.Info.Ts)
 			self.last_date = tr
 		}
+		out := self.options.DiskGuard(m.Info.Ts, m.Info.Level, self.filename, &self.files, self.out)
+		if out == nil {
+			continue
+		}
+		var w io.Writer
+		if self.log_limit > 0 {
+			w = &LimitWriter_t{Buf: out, Limit: self.log_limit}
+		} else {
+			w = out
+		}
 		for _, v := range self.prefix {
 			if n, err = v.FormatMessage(w, m); err != nil {
 				self.write_error_cnt++
@@ -74,33 +108,49 @@ func (self *WriterFileTime_t) Size() (res QueueSize_t) {
 	res.QueueWrite = self.queue_write
 	res.WriteErrorCnt = self.write_error_cnt
 	res.WriteErrorMsg = self.write_error_msg
+	self.options.Stats(&res)
 	self.mx.Unlock()
 	return
 }
 
 func (self *WriterFileTime_t) Close() (err error) {
 	self.mx.Lock()
-	if self.out != nil {
-		if err = self.out.Close(); err == nil {
-			self.out = nil
-		}
+	out := self.out
+	self.out = nil
+	if self.done != nil {
+		close(self.done)
+		self.done = nil
 	}
 	self.mx.Unlock()
+	err = self.options.Close(out)
+	self.wg.Wait()
+	return
+}
+
+// reopens log file after external rotation
+func (self *WriterFileTime_t) Reopen() (err error) {
+	self.mx.Lock()
+	defer self.mx.Unlock()
+	return self.__reopen()
+}
+
+func (self *WriterFileTime_t) __reopen() (err error) {
+	if self.out != nil {
+		self.out.Close()
+	}
+	self.out, err = self.options.Reopen(self.filename)
 	return
 }
 
 func (self *WriterFileTime_t) __cycle(ts time.Time) (err error) {
 	if self.out != nil {
 		self.cycle++
-		self.out.Close()
+		self.options.Release(&self.wg, self.out)
 		backlog_file := fmt.Sprintf("%s.%d.%s", self.filename, self.cycle, ts.Format(FileTime))
 		os.Rename(self.filename, backlog_file)
-		self.files = append(self.files, backlog_file)
-	}
-	if len(self.files) > self.backup_count {
-		os.Remove(self.files[0])
-		self.files = self.files[1:]
+		self.files = append(self.files, self.options.Backup(&self.wg, backlog_file))
 	}
-	self.out, err = os.OpenFile(self.filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC /*|os.O_APPEND*/, 0644)
+	self.files = self.options.Retention(ts, self.files, self.backup_count)
+	self.out, err = self.options.Open(self.filename)
 	return
 }
@@ -0,0 +1,509 @@
+//
+// Fluentd Forward protocol writer, PackedForward and CompressedPackedForward modes
+//
+
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ERROR_MSGPACK = errors.New("MSGPACK")
+
+type Fluent_t struct {
+	mx              sync.Mutex
+	urls            Urls
+	message         Formatter
+	app_name        string
+	app_version     string
+	tag_prefix      string
+	compress        bool
+	ack             bool
+	dial_timeout    time.Duration
+	timeout         time.Duration
+	conn            net.Conn
+	queue_write     int
+	write_error_cnt int
+	write_error_msg string
+}
+
+type FluentOption func(self *Fluent_t)
+
+// tag is tag_prefix.level, default tag_prefix is app_name
+func FluentTagPrefix(tag_prefix string) FluentOption {
+	return func(self *Fluent_t) {
+		self.tag_prefix = tag_prefix
+	}
+}
+
+// formatter for "message" field, default NewPartTextMessage()
+func FluentMessage(message Formatter) FluentOption {
+	return func(self *Fluent_t) {
+		self.message = message
+	}
+}
+
+// CompressedPackedForward mode
+func FluentGzip() FluentOption {
+	return func(self *Fluent_t) {
+		self.compress = true
+	}
+}
+
+// wait for {"ack": chunk} response, chunk is resent to next url if not acknowledged
+func FluentAck() FluentOption {
+	return func(self *Fluent_t) {
+		self.ack = true
+	}
+}
+
+func FluentTimeout(dial_timeout time.Duration, timeout time.Duration) FluentOption {
+	return func(self *Fluent_t) {
+		self.dial_timeout = dial_timeout
+		self.timeout = timeout
+	}
+}
+
+// urls are fluentd addresses host:port
+func NewWriterFluent(urls Urls, app_name string, app_version string, opts ...FluentOption) Queue {
+	self := &Fluent_t{
+		urls:         urls,
+		message:      NewPartTextMessage(),
+		app_name:     app_name,
+		app_version:  app_version,
+		tag_prefix:   app_name,
+		dial_timeout: 5 * time.Second,
+		timeout:      10 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(self)
+	}
+
+	return self
+}
+
+func (self *Fluent_t) LogWrite(msg []Msg_t) (n int, err error) {
+	if len(msg) == 0 {
+		return
+	}
+
+	self.mx.Lock()
+	defer self.mx.Unlock()
+
+	self.queue_write += len(msg)
+
+	var tags []string
+	var message bytes.Buffer
+	entries := map[string]*bytes.Buffer{}
+	count := map[string]int{}
+	for _, m := range msg {
+		tag := self.tag(m.Info.Level)
+		entry, ok := entries[tag]
+		if !ok {
+			entry = &bytes.Buffer{}
+			entries[tag] = entry
+			tags = append(tags, tag)
+		}
+		message.Reset()
+		if _, err = self.message.FormatMessage(&message, m); err != nil {
+			self.write_error_cnt++
+			self.write_error_msg = err.Error()
+			return
+		}
+		entry.Write(self.entry(m, message.Bytes()))
+		count[tag]++
+	}
+
+	for _, tag := range tags {
+		if err = self.__send(tag, entries[tag].Bytes(), count[tag]); err != nil {
+			self.write_error_cnt++
+			self.write_error_msg = err.Error()
+			return
+		}
+	}
+	return
+}
+
+func (self *Fluent_t) tag(level int64) string {
+	if len(self.tag_prefix) == 0 {
+		return strings.ToLower(LevelName(level))
+	}
+	return self.tag_prefix + "." + strings.ToLower(LevelName(level))
+}
+
+// [EventTime, {record}]
+func (self *Fluent_t) entry(m Msg_t, message []byte) (b []byte) {
+	var tags [][2]string
+	for _, v := range m.Args {
+		if temp, ok := v.(Tag); ok {
+			tags = append(tags, [2]string{temp.TagKey(), temp.TagValue()})
+		}
+	}
+	var context_id string
+	if v := GetLogBuffer(m.Ctx); v != nil {
+		context_id = v.BufferGet("id")
+	}
+
+	fields := 3
+	if len(tags) > 0 {
+		fields++
+	}
+	if len(context_id) > 0 {
+		fields++
+	}
+	if len(self.app_name) > 0 {
+		fields++
+	}
+	if len(self.app_version) > 0 {
+		fields++
+	}
+
+	b = msgpack_array(b, 2)
+	b = msgpack_time(b, m.Info.Ts)
+	b = msgpack_map(b, fields)
+	b = msgpack_str(b, "level")
+	b = msgpack_str(b, LevelName(m.Info.Level))
+	b = msgpack_str(b, "message")
+	b = msgpack_str(b, string(message))
+	b = msgpack_str(b, "location")
+	b = msgpack_str(b, FileLine(m.Info.File, m.Info.Line))
+	if len(tags) > 0 {
+		b = msgpack_str(b, "tags")
+		b = msgpack_map(b, len(tags))
+		for _, v := range tags {
+			b = msgpack_str(b, v[0])
+			b = msgpack_str(b, v[1])
+		}
+	}
+	if len(context_id) > 0 {
+		b = msgpack_str(b, "context_id")
+		b = msgpack_str(b, context_id)
+	}
+	if len(self.app_name) > 0 {
+		b = msgpack_str(b, "app_name")
+		b = msgpack_str(b, self.app_name)
+	}
+	if len(self.app_version) > 0 {
+		b = msgpack_str(b, "app_version")
+		b = msgpack_str(b, self.app_version)
+	}
+	return
+}
+
+// [tag, entries, {"size": count, "chunk": id, "compressed": "gzip"}]
+func (self *Fluent_t) __send(tag string, entries []byte, count int) (err error) {
+	if self.compress {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(entries)
+		gz.Close()
+		entries = buf.Bytes()
+	}
+
+	var chunk string
+	options := 1
+	if self.ack {
+		var id [16]byte
+		rand.Read(id[:])
+		chunk = base64.StdEncoding.EncodeToString(id[:])
+		options++
+	}
+	if self.compress {
+		options++
+	}
+
+	b := msgpack_array(nil, 3)
+	b = msgpack_str(b, tag)
+	b = msgpack_bin(b, entries)
+	b = msgpack_map(b, options)
+	b = msgpack_str(b, "size")
+	b = msgpack_uint(b, uint64(count))
+	if self.ack {
+		b = msgpack_str(b, "chunk")
+		b = msgpack_str(b, chunk)
+	}
+	if self.compress {
+		b = msgpack_str(b, "compressed")
+		b = msgpack_str(b, "gzip")
+	}
+
+	for _, addr := range self.urls.Range() {
+		if err = self.__forward(addr, b, chunk); err == nil {
+			return
+		}
+		if self.conn != nil {
+			self.conn.Close()
+			self.conn = nil
+		}
+	}
+	return
+}
+
+func (self *Fluent_t) __forward(addr string, b []byte, chunk string) (err error) {
+	if self.conn == nil {
+		if self.conn, err = net.DialTimeout("tcp", addr, self.dial_timeout); err != nil {
+			return
+		}
+	}
+	self.conn.SetDeadline(time.Now().Add(self.timeout))
+	if _, err = self.conn.Write(b); err != nil {
+		return
+	}
+	if len(chunk) == 0 {
+		return
+	}
+	// response may come in several reads, read until decoded or deadline
+	var resp []byte
+	var p [512]byte
+	var value any
+	for {
+		var n int
+		n, err = self.conn.Read(p[:])
+		resp = append(resp, p[:n]...)
+		var e error
+		if value, _, e = msgpack_decode(resp); e == nil {
+			err = nil
+			break
+		}
+		if err != nil {
+			return
+		}
+	}
+	if m, _ := value.(map[string]any); m["ack"] != chunk {
+		err = fmt.Errorf("fluent ack %v, expected %v", m["ack"], chunk)
+	}
+	return
+}
+
+func (self *Fluent_t) Size() (res QueueSize_t) {
+	self.mx.Lock()
+	res.Connected = self.conn != nil
+	res.QueueWrite = self.queue_write
+	res.WriteErrorCnt = self.write_error_cnt
+	res.WriteErrorMsg = self.write_error_msg
+	self.mx.Unlock()
+	return
+}
+
+func (self *Fluent_t) Close() (err error) {
+	self.mx.Lock()
+	if self.conn != nil {
+		err = self.conn.Close()
+		self.conn = nil
+	}
+	self.mx.Unlock()
+	return
+}
+
+func msgpack_array(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+	}
+}
+
+func msgpack_map(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(n))
+	}
+}
+
+func msgpack_str(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func msgpack_bin(b []byte, p []byte) []byte {
+	switch n := len(p); {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xc5), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xc6), uint32(n))
+	}
+	return append(b, p...)
+}
+
+func msgpack_uint(b []byte, n uint64) []byte {
+	switch {
+	case n < 128:
+		return append(b, byte(n))
+	case n <= math.MaxUint8:
+		return append(b, 0xcc, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), n)
+	}
+}
+
+// fluentd EventTime, ext type 0
+func msgpack_time(b []byte, ts time.Time) []byte {
+	b = append(b, 0xd7, 0x00)
+	b = binary.BigEndian.AppendUint32(b, uint32(ts.Unix()))
+	return binary.BigEndian.AppendUint32(b, uint32(ts.Nanosecond()))
+}
+
+// ext values are returned as []byte, maps as map[string]any
+func msgpack_decode(b []byte) (value any, rest []byte, err error) {
+	if len(b) == 0 {
+		return nil, b, ERROR_MSGPACK
+	}
+	// lengths of str, bin and ext are checked before allocation, short input returns zeros for fixed size values
+	var zero [9]byte
+	next := func(n int) (res []byte) {
+		if n < 0 || len(b) < n {
+			err = ERROR_MSGPACK
+			return zero[:min(max(n, 1), len(zero))]
+		}
+		res, b = b[:n], b[n:]
+		return
+	}
+	c := b[0]
+	b = b[1:]
+	var size int
+	switch {
+	case c <= 0x7f:
+		return int64(c), b, nil
+	case c >= 0xe0:
+		return int64(int8(c)), b, nil
+	case c&0xf0 == 0x80:
+		return msgpack_decode_map(b, int(c&0x0f))
+	case c&0xf0 == 0x90:
+		return msgpack_decode_array(b, int(c&0x0f))
+	case c&0xe0 == 0xa0:
+		value = string(next(int(c & 0x1f)))
+		return value, b, err
+	}
+	switch c {
+	case 0xc0:
+		return nil, b, nil
+	case 0xc2:
+		return false, b, nil
+	case 0xc3:
+		return true, b, nil
+	case 0xcc:
+		value = int64(next(1)[0])
+	case 0xcd:
+		value = int64(binary.BigEndian.Uint16(next(2)))
+	case 0xce:
+		value = int64(binary.BigEndian.Uint32(next(4)))
+	case 0xcf:
+		value = int64(binary.BigEndian.Uint64(next(8)))
+	case 0xd0:
+		value = int64(int8(next(1)[0]))
+	case 0xd1:
+		value = int64(int16(binary.BigEndian.Uint16(next(2))))
+	case 0xd2:
+		value = int64(int32(binary.BigEndian.Uint32(next(4))))
+	case 0xd3:
+		value = int64(binary.BigEndian.Uint64(next(8)))
+	case 0xca:
+		value = float64(math.Float32frombits(binary.BigEndian.Uint32(next(4))))
+	case 0xcb:
+		value = math.Float64frombits(binary.BigEndian.Uint64(next(8)))
+	case 0xd9:
+		value = string(next(int(next(1)[0])))
+	case 0xda:
+		value = string(next(int(binary.BigEndian.Uint16(next(2)))))
+	case 0xdb:
+		value = string(next(int(binary.BigEndian.Uint32(next(4)))))
+	case 0xc4:
+		value = next(int(next(1)[0]))
+	case 0xc5:
+		value = next(int(binary.BigEndian.Uint16(next(2))))
+	case 0xc6:
+		value = next(int(binary.BigEndian.Uint32(next(4))))
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		value = next(1 + 1<<(c-0xd4))[1:]
+	case 0xc7:
+		size = int(next(1)[0])
+		value = next(1 + size)[1:]
+	case 0xc8:
+		size = int(binary.BigEndian.Uint16(next(2)))
+		value = next(1 + size)[1:]
+	case 0xc9:
+		size = int(binary.BigEndian.Uint32(next(4)))
+		value = next(1 + size)[1:]
+	case 0xdc:
+		size = int(binary.BigEndian.Uint16(next(2)))
+		if err == nil {
+			return msgpack_decode_array(b, size)
+		}
+	case 0xdd:
+		size = int(binary.BigEndian.Uint32(next(4)))
+		if err == nil {
+			return msgpack_decode_array(b, size)
+		}
+	case 0xde:
+		size = int(binary.BigEndian.Uint16(next(2)))
+		if err == nil {
+			return msgpack_decode_map(b, size)
+		}
+	case 0xdf:
+		size = int(binary.BigEndian.Uint32(next(4)))
+		if err == nil {
+			return msgpack_decode_map(b, size)
+		}
+	default:
+		err = ERROR_MSGPACK
+	}
+	return value, b, err
+}
+
+func msgpack_decode_array(b []byte, n int) (value any, rest []byte, err error) {
+	var res []any
+	for ; n > 0 && err == nil; n-- {
+		if value, b, err = msgpack_decode(b); err == nil {
+			res = append(res, value)
+		}
+	}
+	return res, b, err
+}
+
+func msgpack_decode_map(b []byte, n int) (value any, rest []byte, err error) {
+	var key any
+	res := map[string]any{}
+	for ; n > 0 && err == nil; n-- {
+		if key, b, err = msgpack_decode(b); err != nil {
+			break
+		}
+		if value, b, err = msgpack_decode(b); err == nil {
+			res[fmt.Sprint(key)] = value
+		}
+	}
+	return res, b, err
+}
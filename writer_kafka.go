@@ -0,0 +1,348 @@
+//
+// Kafka producer, minimal protocol client: Produce v3, RecordBatch v2, no compression
+//
+
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+type Kafka_t struct {
+	mx              sync.Mutex
+	urls            Urls
+	message         Formatter
+	topic           string
+	client_id       string
+	key_tag         string
+	acks            int16
+	partitions      int32
+	next_partition  int32
+	dial_timeout    time.Duration
+	timeout         time.Duration
+	conn            net.Conn
+	correlation_id  int32
+	queue_write     int
+	write_error_cnt int
+	write_error_msg string
+}
+
+type KafkaOption func(self *Kafka_t)
+
+// 0 - no response, 1 - leader only, -1 - all in-sync replicas
+func KafkaAcks(acks int16) KafkaOption {
+	return func(self *Kafka_t) {
+		self.acks = acks
+	}
+}
+
+// records are spread over partitions by key hash, records without key are spread round-robin
+// broker must be leader for all partitions of topic
+func KafkaPartitions(partitions int32) KafkaOption {
+	return func(self *Kafka_t) {
+		self.partitions = partitions
+	}
+}
+
+// value of Tag with key tag_key is used as record key
+// context buffer id is used if tag not found
+func KafkaKeyTag(tag_key string) KafkaOption {
+	return func(self *Kafka_t) {
+		self.key_tag = tag_key
+	}
+}
+
+func KafkaClientId(client_id string) KafkaOption {
+	return func(self *Kafka_t) {
+		self.client_id = client_id
+	}
+}
+
+func KafkaTimeout(dial_timeout time.Duration, timeout time.Duration) KafkaOption {
+	return func(self *Kafka_t) {
+		self.dial_timeout = dial_timeout
+		self.timeout = timeout
+	}
+}
+
+// urls are broker addresses host:port
+// use with NewQueue(limit, 1, bulk_write, kafka) to batch messages into single produce request
+func NewWriterKafka(urls Urls, topic string, message Formatter, opts ...KafkaOption) Queue {
+	self := &Kafka_t{
+		urls:         urls,
+		message:      message,
+		topic:        topic,
+		client_id:    "go-log",
+		acks:         1,
+		partitions:   1,
+		dial_timeout: 5 * time.Second,
+		timeout:      10 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(self)
+	}
+
+	if self.partitions < 1 {
+		self.partitions = 1
+	}
+
+	return self
+}
+
+func (self *Kafka_t) LogWrite(msg []Msg_t) (n int, err error) {
+	if len(msg) == 0 {
+		return
+	}
+
+	self.mx.Lock()
+	defer self.mx.Unlock()
+
+	self.queue_write += len(msg)
+
+	if err = self.__write(msg); err != nil {
+		self.write_error_cnt++
+		self.write_error_msg = err.Error()
+	}
+	return
+}
+
+func (self *Kafka_t) __write(msg []Msg_t) (err error) {
+	var value bytes.Buffer
+	batches := map[int32]*kafka_batch_t{}
+	self.next_partition = (self.next_partition + 1) % self.partitions
+	for _, m := range msg {
+		value.Reset()
+		if _, err = self.message.FormatMessage(&value, m); err != nil {
+			return
+		}
+		key := self.key(m)
+		partition := self.next_partition
+		if key != nil && self.partitions > 1 {
+			h := fnv.New32a()
+			h.Write(key)
+			partition = int32(h.Sum32() % uint32(self.partitions))
+		}
+		batch, ok := batches[partition]
+		if !ok {
+			batch = &kafka_batch_t{base_ts: m.Info.Ts.UnixMilli()}
+			batches[partition] = batch
+		}
+		batch.Add(m.Info.Ts.UnixMilli(), key, value.Bytes())
+	}
+
+	for _, addr := range self.urls.Range() {
+		self.correlation_id++
+		if err = self.__produce(addr, self.produce_request(batches)); err == nil {
+			return
+		}
+		if self.conn != nil {
+			self.conn.Close()
+			self.conn = nil
+		}
+	}
+	return
+}
+
+func (self *Kafka_t) key(m Msg_t) []byte {
+	if len(self.key_tag) > 0 {
+		for _, v := range m.Args {
+			if temp, ok := v.(Tag); ok && temp.TagKey() == self.key_tag {
+				return []byte(temp.TagValue())
+			}
+		}
+	}
+	if v := GetLogBuffer(m.Ctx); v != nil {
+		if id := v.BufferGet("id"); len(id) > 0 {
+			return []byte(id)
+		}
+	}
+	return nil
+}
+
+func (self *Kafka_t) __produce(addr string, req []byte) (err error) {
+	if self.conn == nil {
+		if self.conn, err = net.DialTimeout("tcp", addr, self.dial_timeout); err != nil {
+			return
+		}
+	}
+	self.conn.SetDeadline(time.Now().Add(self.timeout))
+	if _, err = self.conn.Write(req); err != nil {
+		return
+	}
+	if self.acks == 0 {
+		return
+	}
+	var size [4]byte
+	if _, err = io.ReadFull(self.conn, size[:]); err != nil {
+		return
+	}
+	resp := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err = io.ReadFull(self.conn, resp); err != nil {
+		return
+	}
+	return self.produce_response(resp)
+}
+
+func (self *Kafka_t) produce_request(batches map[int32]*kafka_batch_t) []byte {
+	// size placeholder
+	b := make([]byte, 4, 1024)
+	// request header v1
+	b = binary.BigEndian.AppendUint16(b, 0) // api key Produce
+	b = binary.BigEndian.AppendUint16(b, 3) // api version
+	b = binary.BigEndian.AppendUint32(b, uint32(self.correlation_id))
+	b = kafka_string(b, self.client_id)
+	// produce request v3
+	b = binary.BigEndian.AppendUint16(b, 0xFFFF) // transactional_id null
+	b = binary.BigEndian.AppendUint16(b, uint16(self.acks))
+	b = binary.BigEndian.AppendUint32(b, uint32(self.timeout.Milliseconds()))
+	b = binary.BigEndian.AppendUint32(b, 1) // topics
+	b = kafka_string(b, self.topic)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(batches)))
+	for partition, batch := range batches {
+		b = binary.BigEndian.AppendUint32(b, uint32(partition))
+		b = batch.Append(b)
+	}
+	binary.BigEndian.PutUint32(b, uint32(len(b)-4))
+	return b
+}
+
+func (self *Kafka_t) produce_response(b []byte) (err error) {
+	r := kafka_reader_t{b: b}
+	if correlation_id := r.ReadInt32(); correlation_id != self.correlation_id {
+		return fmt.Errorf("kafka correlation id %v, expected %v", correlation_id, self.correlation_id)
+	}
+	for topics := r.ReadInt32(); topics > 0; topics-- {
+		r.ReadString()
+		for partitions := r.ReadInt32(); partitions > 0; partitions-- {
+			partition := r.ReadInt32()
+			if code := r.ReadInt16(); code != 0 {
+				return fmt.Errorf("kafka topic %v partition %v error code %v", self.topic, partition, code)
+			}
+			r.ReadInt64() // base_offset
+			r.ReadInt64() // log_append_time
+		}
+	}
+	return r.err
+}
+
+func (self *Kafka_t) Size() (res QueueSize_t) {
+	self.mx.Lock()
+	res.QueueWrite = self.queue_write
+	res.WriteErrorCnt = self.write_error_cnt
+	res.WriteErrorMsg = self.write_error_msg
+	self.mx.Unlock()
+	return
+}
+
+func (self *Kafka_t) Close() (err error) {
+	self.mx.Lock()
+	if self.conn != nil {
+		err = self.conn.Close()
+		self.conn = nil
+	}
+	self.mx.Unlock()
+	return
+}
+
+// RecordBatch v2
+type kafka_batch_t struct {
+	records []byte
+	count   int32
+	base_ts int64
+	max_ts  int64
+}
+
+func (self *kafka_batch_t) Add(ts int64, key []byte, value []byte) {
+	var rec []byte
+	rec = append(rec, 0) // attributes
+	rec = binary.AppendVarint(rec, ts-self.base_ts)
+	rec = binary.AppendVarint(rec, int64(self.count))
+	if key == nil {
+		rec = binary.AppendVarint(rec, -1)
+	} else {
+		rec = binary.AppendVarint(rec, int64(len(key)))
+		rec = append(rec, key...)
+	}
+	rec = binary.AppendVarint(rec, int64(len(value)))
+	rec = append(rec, value...)
+	rec = binary.AppendVarint(rec, 0) // headers
+	self.records = binary.AppendVarint(self.records, int64(len(rec)))
+	self.records = append(self.records, rec...)
+	if ts > self.max_ts {
+		self.max_ts = ts
+	}
+	self.count++
+}
+
+// appends records as int32 size + RecordBatch
+func (self *kafka_batch_t) Append(b []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(61+len(self.records)))
+	b = binary.BigEndian.AppendUint64(b, 0)                            // base offset
+	b = binary.BigEndian.AppendUint32(b, uint32(49+len(self.records))) // batch length
+	b = binary.BigEndian.AppendUint32(b, 0xFFFFFFFF)                   // partition leader epoch
+	b = append(b, 2)                                                   // magic
+	crc_pos := len(b)
+	b = binary.BigEndian.AppendUint32(b, 0)
+	b = binary.BigEndian.AppendUint16(b, 0) // attributes
+	b = binary.BigEndian.AppendUint32(b, uint32(self.count-1))
+	b = binary.BigEndian.AppendUint64(b, uint64(self.base_ts))
+	b = binary.BigEndian.AppendUint64(b, uint64(max(self.max_ts, self.base_ts)))
+	b = binary.BigEndian.AppendUint64(b, 0xFFFFFFFFFFFFFFFF) // producer id
+	b = binary.BigEndian.AppendUint16(b, 0xFFFF)             // producer epoch
+	b = binary.BigEndian.AppendUint32(b, 0xFFFFFFFF)         // base sequence
+	b = binary.BigEndian.AppendUint32(b, uint32(self.count))
+	b = append(b, self.records...)
+	binary.BigEndian.PutUint32(b[crc_pos:], crc32.Checksum(b[crc_pos+4:], crc32c))
+	return b
+}
+
+func kafka_string(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+type kafka_reader_t struct {
+	b   []byte
+	err error
+}
+
+func (self *kafka_reader_t) next(n int) (res []byte) {
+	if len(self.b) < n {
+		self.err = io.ErrUnexpectedEOF
+		self.b = nil
+		return make([]byte, n)
+	}
+	res, self.b = self.b[:n], self.b[n:]
+	return
+}
+
+func (self *kafka_reader_t) ReadInt16() int16 {
+	return int16(binary.BigEndian.Uint16(self.next(2)))
+}
+
+func (self *kafka_reader_t) ReadInt32() int32 {
+	return int32(binary.BigEndian.Uint32(self.next(4)))
+}
+
+func (self *kafka_reader_t) ReadInt64() int64 {
+	return int64(binary.BigEndian.Uint64(self.next(8)))
+}
+
+func (self *kafka_reader_t) ReadString() string {
+	n := self.ReadInt16()
+	if n < 0 {
+		return ""
+	}
+	return string(self.next(int(n)))
+}
@@ -0,0 +1,207 @@
+//
+// Stream writer to tcp, udp, unix sockets with reconnect
+//
+
+package log
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+type WriterSocket_t struct {
+	mx              sync.Mutex
+	prefix          []Formatter
+	network         string
+	address         string
+	packet          bool
+	conn            net.Conn
+	dial_timeout    time.Duration
+	write_timeout   time.Duration
+	backoff_min     time.Duration
+	backoff_max     time.Duration
+	backoff         time.Duration
+	next_dial       time.Time
+	pending         net.Buffers
+	pending_bytes   int
+	buffer_limit    int
+	log_limit       int
+	reconnect       int
+	queue_write     int
+	queue_overflow  int
+	write_error_cnt int
+	write_error_msg string
+}
+
+type SocketOption func(self *WriterSocket_t)
+
+func SocketDialTimeout(timeout time.Duration) SocketOption {
+	return func(self *WriterSocket_t) {
+		self.dial_timeout = timeout
+	}
+}
+
+func SocketWriteTimeout(timeout time.Duration) SocketOption {
+	return func(self *WriterSocket_t) {
+		self.write_timeout = timeout
+	}
+}
+
+// delay between dial attempts doubles from backoff_min to backoff_max
+func SocketBackoff(backoff_min time.Duration, backoff_max time.Duration) SocketOption {
+	return func(self *WriterSocket_t) {
+		self.backoff_min = backoff_min
+		self.backoff_max = backoff_max
+	}
+}
+
+// bytes kept while disconnected, new messages are dropped when limit reached
+func SocketBufferLimit(limit int) SocketOption {
+	return func(self *WriterSocket_t) {
+		self.buffer_limit = limit
+	}
+}
+
+func SocketLogLimit(limit int) SocketOption {
+	return func(self *WriterSocket_t) {
+		self.log_limit = limit
+	}
+}
+
+// network: "tcp", "tcp4", "tcp6", "unix" - stream, "udp", "udp4", "udp6", "unixgram" - one message per packet
+func NewWriterSocket(network string, address string, prefix []Formatter, opts ...SocketOption) Queue {
+	self := &WriterSocket_t{
+		prefix:        prefix,
+		network:       network,
+		address:       address,
+		dial_timeout:  5 * time.Second,
+		write_timeout: 5 * time.Second,
+		backoff_min:   100 * time.Millisecond,
+		backoff_max:   30 * time.Second,
+		buffer_limit:  1024 * 1024,
+	}
+
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		self.packet = true
+	}
+
+	for _, opt := range opts {
+		opt(self)
+	}
+
+	self.backoff = self.backoff_min
+
+	return self
+}
+
+func (self *WriterSocket_t) LogWrite(msg []Msg_t) (n int, err error) {
+	self.mx.Lock()
+	defer self.mx.Unlock()
+	for _, m := range msg {
+		self.queue_write++
+		var buf bytes.Buffer
+		var w io.Writer
+		if self.log_limit > 0 {
+			w = &LimitWriter_t{Buf: &buf, Limit: self.log_limit}
+		} else {
+			w = &buf
+		}
+		for _, v := range self.prefix {
+			if _, err = v.FormatMessage(w, m); err != nil {
+				self.write_error_cnt++
+				self.write_error_msg = err.Error()
+				return
+			}
+		}
+		if self.pending_bytes+buf.Len() > self.buffer_limit {
+			self.queue_overflow++
+			err = ERROR_OVERFLOW
+			continue
+		}
+		self.pending = append(self.pending, buf.Bytes())
+		self.pending_bytes += buf.Len()
+	}
+	if e := self.__flush(time.Now()); e != nil {
+		self.write_error_cnt++
+		self.write_error_msg = e.Error()
+		err = e
+	}
+	return
+}
+
+func (self *WriterSocket_t) __flush(ts time.Time) (err error) {
+	if len(self.pending) == 0 {
+		return
+	}
+	if self.conn == nil {
+		if ts.Before(self.next_dial) {
+			return
+		}
+		if self.conn, err = net.DialTimeout(self.network, self.address, self.dial_timeout); err != nil {
+			self.next_dial = ts.Add(self.backoff)
+			self.backoff = min(2*self.backoff, self.backoff_max)
+			return
+		}
+		self.reconnect++
+		self.backoff = self.backoff_min
+	}
+	if self.write_timeout > 0 {
+		self.conn.SetWriteDeadline(ts.Add(self.write_timeout))
+	}
+	if self.packet {
+		for len(self.pending) > 0 {
+			if _, err = self.conn.Write(self.pending[0]); err != nil {
+				break
+			}
+			self.pending_bytes -= len(self.pending[0])
+			self.pending = self.pending[1:]
+		}
+	} else {
+		// WriteTo consumes buffers, pending keeps message boundaries
+		bufs := make(net.Buffers, len(self.pending))
+		copy(bufs, self.pending)
+		var n int64
+		n, err = bufs.WriteTo(self.conn)
+		// partially written message is sent whole after reconnect
+		for len(self.pending) > 0 && n >= int64(len(self.pending[0])) {
+			n -= int64(len(self.pending[0]))
+			self.pending_bytes -= len(self.pending[0])
+			self.pending = self.pending[1:]
+		}
+	}
+	if err != nil {
+		self.conn.Close()
+		self.conn = nil
+	}
+	return
+}
+
+// Limit, Size - buffer limit and pending bytes
+func (self *WriterSocket_t) Size() (res QueueSize_t) {
+	self.mx.Lock()
+	res.Limit = self.buffer_limit
+	res.Size = self.pending_bytes
+	res.Connected = self.conn != nil
+	res.Reconnect = self.reconnect
+	res.QueueWrite = self.queue_write
+	res.QueueOverflow = self.queue_overflow
+	res.WriteErrorCnt = self.write_error_cnt
+	res.WriteErrorMsg = self.write_error_msg
+	self.mx.Unlock()
+	return
+}
+
+func (self *WriterSocket_t) Close() (err error) {
+	self.mx.Lock()
+	self.__flush(time.Now())
+	if self.conn != nil {
+		err = self.conn.Close()
+		self.conn = nil
+	}
+	self.mx.Unlock()
+	return
+}